@@ -0,0 +1,132 @@
+package eventsource
+
+import (
+	"bytes"
+	"slices"
+	"time"
+)
+
+// Batches of messages are delivered via this callback. See: WithBatching.
+type BatchCallback func(msgs []Message, err error)
+
+// Clone returns a deep copy of the message, it's safe to retain it after the callback returns.
+func (m Message) Clone() Message {
+	m.ID = bytes.Clone(m.ID)
+	m.Event = bytes.Clone(m.Event)
+	m.Data = bytes.Clone(m.Data)
+	return m
+}
+
+// CloneContiguous is like Clone, but all fields are copied into a single allocation, which is returned as well. The
+// fields of the returned message are sub-slices of it (capped, appending to a field never overwrites another one).
+// Retain-heavy consumers may pool the backing slices to reduce allocations: once the message is no longer used, its
+// backing slice can be put to a pool and passed to the next CloneContiguous call via m.AppendContiguous.
+func (m Message) CloneContiguous() (Message, []byte) {
+	return m.AppendContiguous(nil)
+}
+
+// AppendContiguous is like CloneContiguous, but the fields are appended to buf[:0], reusing its capacity if possible.
+func (m Message) AppendContiguous(buf []byte) (Message, []byte) {
+	buf = slices.Grow(buf[:0], len(m.ID)+len(m.Event)+len(m.Data))
+	field := func(f []byte) []byte {
+		if f == nil {
+			return nil
+		}
+		start := len(buf)
+		buf = append(buf, f...)
+		return buf[start:len(buf):len(buf)]
+	}
+	m.ID = field(m.ID)
+	m.Event = field(m.Event)
+	m.Data = field(m.Data)
+	return m, buf
+}
+
+// Enables batching of messages. Messages are cloned and accumulated, the batch is delivered to the callback once it
+// has maxSize messages or once maxDelay passes since the first message was added to it, whichever happens first.
+// An error flushes the pending batch first and then it's delivered alone, with nil msgs. When EventSource stops, the
+// pending batch is flushed as well. Batches delivered on timer are delivered from a different goroutine, but the
+// callback is never called concurrently. Can't be used together with WithCallback or WithConsumingCallback.
+func WithBatching(maxSize int, maxDelay time.Duration, callback BatchCallback) Option {
+	return func(es *EventSource) {
+		es.batchCallback = callback
+		es.batchSize = maxSize
+		es.batchDelay = maxDelay
+	}
+}
+
+// Limits the total size of cloned messages which were not handled by the callback yet. When the next message would
+// exceed the limit, backpressure is applied: the read loop is blocked until pending messages are handled. In batching
+// mode (see WithBatching) it means the pending batch is flushed right away, regardless of its size and age. With the
+// dispatch queue (see WithDispatchQueue) the queue policy applies, i.e. the message is dropped with QueueFullDrop. A
+// single message larger than the limit is let through when nothing is pending. Message size is the total length of
+// its ID, Event and Data. Zero (the default) means no limit.
+func WithMaxPendingBytes(n int64) Option {
+	return func(es *EventSource) {
+		es.maxPendingBytes = n
+	}
+}
+
+// Size of the message as WithMaxPendingBytes counts it.
+func messageSize(msg Message) int64 {
+	return int64(len(msg.ID) + len(msg.Event) + len(msg.Data))
+}
+
+func (es *EventSource) callBatchCallback(msgs []Message, err error) {
+	if es.panicHandler != nil {
+		defer es.recoverCallbackPanic()
+	}
+	es.batchCallback(msgs, err)
+}
+
+// Must be called with batchMu held.
+func (es *EventSource) flushBatchLocked() {
+	if es.batchTimer != nil {
+		es.batchTimer.Stop()
+		es.batchTimer = nil
+	}
+	if len(es.batch) == 0 {
+		return
+	}
+	msgs := es.batch
+	// the callback may retain the slice, hence new one
+	es.batch = nil
+	es.batchBytes = 0
+	es.callBatchCallback(msgs, nil)
+}
+
+func (es *EventSource) addToBatch(msg Message, err error) {
+	es.batchMu.Lock()
+	defer es.batchMu.Unlock()
+	if err != nil {
+		es.flushBatchLocked()
+		es.callBatchCallback(nil, err)
+		return
+	}
+	size := messageSize(msg)
+	if es.maxPendingBytes > 0 && len(es.batch) != 0 && es.batchBytes+size > es.maxPendingBytes {
+		// backpressure, the read loop is blocked until the callback handles the batch
+		es.flushBatchLocked()
+	}
+	es.batch = append(es.batch, msg.Clone())
+	es.batchBytes += size
+	if len(es.batch) >= es.batchSize {
+		es.flushBatchLocked()
+	} else if len(es.batch) == 1 && es.batchDelay > 0 {
+		es.batchTimer = time.AfterFunc(es.batchDelay, func() {
+			es.batchMu.Lock()
+			defer es.batchMu.Unlock()
+			if !es.batchClosed {
+				es.flushBatchLocked()
+			}
+		})
+	}
+}
+
+// Flushes the pending batch when EventSource stops, no callback calls are made after that.
+func (es *EventSource) closeBatch() {
+	es.batchMu.Lock()
+	defer es.batchMu.Unlock()
+	es.flushBatchLocked()
+	es.batchClosed = true
+}
@@ -0,0 +1,93 @@
+package eventsource
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type batch struct {
+	data []string
+	err  error
+}
+
+func collectBatches() (BatchCallback, chan batch) {
+	ch := make(chan batch, 100)
+	return func(msgs []Message, err error) {
+		b := batch{err: err}
+		for _, msg := range msgs {
+			b.data = append(b.data, string(msg.Data))
+		}
+		ch <- b
+	}, ch
+}
+
+func TestBatching(t *testing.T) {
+	assert := assert.New(t)
+	{
+		cb, batches := collectBatches()
+		tr, _ := streamTransport("data: a\n\ndata: b\n\ndata: c\n\ndata: d\n\ndata: e\n\n")
+		es, err := New(WithTransport(tr), WithBatching(2, 50*time.Millisecond, cb))
+		assert.NoError(err)
+		assert.Equal(batch{data: []string{"a", "b"}}, <-batches)
+		assert.Equal(batch{data: []string{"c", "d"}}, <-batches)
+		assert.Equal(batch{data: []string{"e"}}, <-batches)
+		es.Close()
+	}
+	{
+		// error flushes the pending batch and then it's delivered alone
+		cb, batches := collectBatches()
+		tr, _ := streamTransport("data: a\n\ndata: too long\n\ndata: b\n\n")
+		es, err := New(WithTransport(tr), WithBatching(10, time.Hour, cb),
+			WithBufferParameters(BufferParameters{MaxData: 3}))
+		assert.NoError(err)
+		assert.Equal(batch{data: []string{"a"}}, <-batches)
+		b := <-batches
+		assert.Nil(b.data)
+		assert.ErrorIs(b.err, ErrBufferFull)
+		// close flushes the pending batch
+		es.Close()
+		assert.Equal(batch{data: []string{"b"}}, <-batches)
+	}
+}
+
+func TestMaxPendingBytes(t *testing.T) {
+	assert := assert.New(t)
+	cb, batches := collectBatches()
+	tr, _ := streamTransport("data: aaaaaa\n\ndata: bbbbbb\n\ndata: cc\n\ndata: dd\n\ndata: eeeeee\n\n")
+	es, err := New(WithTransport(tr), WithMaxPendingBytes(10), WithBatching(100, time.Hour, func(msgs []Message, err error) {
+		// slow consumer
+		time.Sleep(10 * time.Millisecond)
+		cb(msgs, err)
+	}))
+	assert.NoError(err)
+	assert.Equal(batch{data: []string{"aaaaaa"}}, <-batches)
+	assert.Equal(batch{data: []string{"bbbbbb", "cc", "dd"}}, <-batches)
+	es.Close()
+	assert.Equal(batch{data: []string{"eeeeee"}}, <-batches)
+}
+
+func TestCloneContiguous(t *testing.T) {
+	assert := assert.New(t)
+	src := Message{ID: []byte("1"), Event: []byte("foo"), Data: []byte("bar baz"), DataLineCount: 2}
+	msg, buf := src.CloneContiguous()
+	assert.Equal(src, msg)
+	assert.Equal("1foobar baz", string(buf))
+	// fields share the backing array
+	assert.Same(&buf[0], &msg.ID[0])
+	assert.Same(&buf[1], &msg.Event[0])
+	assert.Same(&buf[4], &msg.Data[0])
+	// and they are copies
+	src.Data[0] = 'X'
+	assert.Equal("bar baz", string(msg.Data))
+	// appending to a field doesn't overwrite the next one
+	_ = append(msg.Event, 'X')
+	assert.Equal("bar baz", string(msg.Data))
+
+	// nil fields stay nil, the buffer is reused
+	msg, buf2 := Message{Data: []byte("qux")}.AppendContiguous(buf)
+	assert.Nil(msg.ID)
+	assert.Nil(msg.Event)
+	assert.Equal("qux", string(msg.Data))
+	assert.Same(&buf[0], &buf2[0])
+}
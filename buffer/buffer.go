@@ -8,6 +8,7 @@ package buffer
 // I'm not inventing much here, using code snippets from "bufio.Reader".
 
 import (
+	"bytes"
 	"errors"
 	"io"
 )
@@ -19,6 +20,10 @@ const minReadBufferSize = 16
 const defaultBufSize = 4096
 const maxConsecutiveEmptyReads = 100
 
+// Diagnostics hook, called on each fill with the number of bytes read, the number of bytes buffered after the
+// read and the current buffer size.
+type FillHook func(n, buffered, size int)
+
 type ReadBuffer struct {
 	buf     []byte
 	rd      io.Reader
@@ -26,6 +31,11 @@ type ReadBuffer struct {
 	err     error
 	maxSize int
 	crLine  bool
+	hook    FillHook
+	minRead int
+	soft    int
+
+	maxEmptyReads int
 }
 
 func New(rd io.Reader, maxSize int) *ReadBuffer {
@@ -37,6 +47,33 @@ func New(rd io.Reader, maxSize int) *ReadBuffer {
 	}
 }
 
+// Same as New, but the hook is called on each fill. Useful for debugging servers with unusual write patterns.
+func NewWithHook(rd io.Reader, maxSize int, hook FillHook) *ReadBuffer {
+	b := New(rd, maxSize)
+	b.hook = hook
+	return b
+}
+
+// Makes each fill keep reading until at least n bytes are read (or the buffer is full, or an error occurs). Reduces the
+// number of reads when the data arrives in tiny chunks, at the cost of latency: a line is not returned until the
+// minimum is reached, even if the line itself is complete.
+func (b *ReadBuffer) SetMinReadChunk(n int) {
+	b.minRead = n
+}
+
+// Sets how many consecutive reads returning no data and no error are tolerated before io.ErrNoProgress is reported,
+// 100 by default (as in bufio.Reader). Values less than 1 restore the default. Some servers behind proxies produce
+// long runs of empty reads (e.g. zero-length chunks) while the stream is fine.
+func (b *ReadBuffer) SetMaxEmptyReads(n int) {
+	b.maxEmptyReads = n
+}
+
+// Makes the buffer shrink back to n bytes once the data it holds fits, after it has grown beyond n to handle a large
+// line. Keeps steady-state memory low while tolerating occasional large lines.
+func (b *ReadBuffer) SetSoftLimit(n int) {
+	b.soft = n
+}
+
 func (b *ReadBuffer) grow() bool {
 	if len(b.buf) >= b.maxSize {
 		return false
@@ -57,6 +94,13 @@ func (b *ReadBuffer) fill() {
 		b.r = 0
 	}
 
+	if b.soft > 0 && len(b.buf) > b.soft && b.w < b.soft {
+		// the large line is processed, shrink back
+		newBuf := make([]byte, b.soft)
+		copy(newBuf, b.buf[:b.w])
+		b.buf = newBuf
+	}
+
 	if b.w >= len(b.buf) {
 		// if there is no space left in the buffer, let's try to grow
 		if !b.grow() {
@@ -66,8 +110,20 @@ func (b *ReadBuffer) fill() {
 		}
 	}
 
+	if b.hook != nil {
+		w := b.w
+		defer func() {
+			b.hook(b.w-w, b.w-b.r, len(b.buf))
+		}()
+	}
+
 	// Read new data: try a limited number of times.
-	for i := maxConsecutiveEmptyReads; i > 0; i-- {
+	start := b.w
+	maxEmptyReads := b.maxEmptyReads
+	if maxEmptyReads < 1 {
+		maxEmptyReads = maxConsecutiveEmptyReads
+	}
+	for i := maxEmptyReads; i > 0; i-- {
 		n, err := b.rd.Read(b.buf[b.w:])
 		if n < 0 {
 			panic(errNegativeRead)
@@ -78,20 +134,27 @@ func (b *ReadBuffer) fill() {
 			return
 		}
 		if n > 0 {
-			return
+			if b.w-start >= b.minRead || b.w == len(b.buf) {
+				return
+			}
+			// keep reading until the minimum chunk is reached, empty reads are counted from now on
+			i = maxEmptyReads + 1
 		}
 	}
 	b.err = io.ErrNoProgress
 }
 
+// Returns the index of the first \r or \n, -1 if there is none. bytes.IndexByte is way faster than a loop on long
+// lines, \r is only searched for before the first \n.
 func findCRLF(buf []byte) int {
-	for i := 0; i < len(buf); i++ {
-		switch buf[i] {
-		case '\r', '\n':
-			return i
-		}
+	n := bytes.IndexByte(buf, '\n')
+	if n == -1 {
+		return bytes.IndexByte(buf, '\r')
+	}
+	if r := bytes.IndexByte(buf[:n], '\r'); r != -1 {
+		return r
 	}
-	return -1
+	return n
 }
 
 func (b *ReadBuffer) readErr() error {
@@ -1,10 +1,14 @@
 package buffer
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"math/rand/v2"
+	"slices"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestReadBuffer(t *testing.T) {
@@ -59,3 +63,235 @@ func TestReadBuffer(t *testing.T) {
 		check("fooba", ErrBufferFull)(br.ReadLine())
 	}
 }
+
+func TestFillHook(t *testing.T) {
+	assert := assert.New(t)
+	type fill struct{ n, buffered, size int }
+	var fills []fill
+	br := NewWithHook(iotest.OneByteReader(strings.NewReader("ab\nc")), 4096, func(n, buffered, size int) {
+		fills = append(fills, fill{n, buffered, size})
+	})
+	line, err := br.ReadLine()
+	assert.Equal("ab", string(line))
+	assert.NoError(err)
+	assert.Equal([]fill{{1, 1, 4096}, {1, 2, 4096}, {1, 3, 4096}}, fills)
+	line, err = br.ReadLine()
+	assert.Equal("c", string(line))
+	assert.Equal(io.EOF, err)
+	assert.Equal([]fill{{1, 1, 4096}, {1, 2, 4096}, {1, 3, 4096}, {1, 1, 4096}, {0, 1, 4096}}, fills)
+}
+
+// chunkReader returns the data in chunks of the given sizes, then in chunks of size (the rest in one go if it's 0).
+type chunkReader struct {
+	data   string
+	chunks []int
+	size   int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := len(r.data)
+	if len(r.chunks) > 0 {
+		n = min(n, r.chunks[0])
+		r.chunks = r.chunks[1:]
+	} else if r.size > 0 {
+		n = min(n, r.size)
+	}
+	n = copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// readLines reads all lines until EOF.
+func readLines(t *testing.T, rd io.Reader) []string {
+	var lines []string
+	br := New(rd, 4096)
+	for {
+		line, err := br.ReadLine()
+		lines = append(lines, string(line))
+		if err != nil {
+			assert.Equal(t, io.EOF, err)
+			return lines
+		}
+	}
+}
+
+func TestSplitTerminators(t *testing.T) {
+	assert := assert.New(t)
+	for _, c := range []struct {
+		input string
+		lines []string
+	}{
+		{"a\r\n\r\nb", []string{"a", "", "b"}},
+		{"a\r\r\nb", []string{"a", "", "b"}},
+		{"a\r\n\nb", []string{"a", "", "b"}},
+		{"a\n\r\nb", []string{"a", "", "b"}},
+		{"a\r\n\r\n", []string{"a", "", ""}},
+		{"\r\n\r\n\r\n", []string{"", "", "", ""}},
+		{"\r\r\n\n\r", []string{"", "", "", "", ""}},
+		{"a\r\nb\r\n\r\nc\rd\r\n", []string{"a", "b", "", "c", "d", ""}},
+	} {
+		assert.Equal(c.lines, readLines(t, strings.NewReader(c.input)), "input: %q", c.input)
+		assert.Equal(c.lines, readLines(t, iotest.OneByteReader(strings.NewReader(c.input))), "input: %q", c.input)
+		// split at every possible position
+		for i := 1; i < len(c.input); i++ {
+			rd := &chunkReader{data: c.input, chunks: []int{i}}
+			assert.Equal(c.lines, readLines(t, rd), "input: %q, split at %d", c.input, i)
+		}
+	}
+}
+
+func TestMinReadChunk(t *testing.T) {
+	assert := assert.New(t)
+	var fills []int
+	br := NewWithHook(iotest.OneByteReader(strings.NewReader("a\nbcdefgh\nij")), 4096, func(n, buffered, size int) {
+		fills = append(fills, n)
+	})
+	br.SetMinReadChunk(4)
+	for _, expected := range []string{"a", "bcdefgh"} {
+		line, err := br.ReadLine()
+		assert.NoError(err)
+		assert.Equal(expected, string(line))
+	}
+	line, err := br.ReadLine()
+	assert.Equal(io.EOF, err)
+	assert.Equal("ij", string(line))
+	assert.Equal([]int{4, 4, 4, 0}, fills)
+}
+
+func BenchmarkMinReadChunk(b *testing.B) {
+	data := strings.Repeat("data: some moderately long line of data\n\n", 1000)
+	for _, minRead := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("min=%d", minRead), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			fills := 0
+			for i := 0; i < b.N; i++ {
+				br := NewWithHook(&chunkReader{data: data, size: 8}, 4096, func(n, buffered, size int) { fills++ })
+				br.SetMinReadChunk(minRead)
+				for {
+					if _, err := br.ReadLine(); err != nil {
+						break
+					}
+				}
+			}
+			b.ReportMetric(float64(fills)/float64(b.N), "fills/op")
+		})
+	}
+}
+
+// findCRLFLoop is the previous implementation of findCRLF, kept for comparison.
+func findCRLFLoop(buf []byte) int {
+	for i := 0; i < len(buf); i++ {
+		switch buf[i] {
+		case '\r', '\n':
+			return i
+		}
+	}
+	return -1
+}
+
+func TestFindCRLF(t *testing.T) {
+	assert := assert.New(t)
+	for _, s := range []string{"", "a", "\r", "\n", "ab\r\ncd", "ab\n\rcd", "abc\r", "abc\n", "a\rb\nc", "a\nb\rc", "abc"} {
+		assert.Equal(findCRLFLoop([]byte(s)), findCRLF([]byte(s)), "input: %q", s)
+	}
+}
+
+func BenchmarkFindCRLF(b *testing.B) {
+	for _, size := range []int{16, 256, 4096, 65536} {
+		line := []byte(strings.Repeat("x", size) + "\r\n")
+		for _, impl := range []struct {
+			name string
+			f    func([]byte) int
+		}{{"loop", findCRLFLoop}, {"IndexByte", findCRLF}} {
+			b.Run(fmt.Sprintf("%s/%d", impl.name, size), func(b *testing.B) {
+				b.SetBytes(int64(len(line)))
+				for i := 0; i < b.N; i++ {
+					impl.f(line)
+				}
+			})
+		}
+	}
+}
+
+func TestSoftLimit(t *testing.T) {
+	assert := assert.New(t)
+	var sizes []int
+	input := "a\n" + strings.Repeat("b", 100) + "\nc\nd\n"
+	br := NewWithHook(&chunkReader{data: input, size: 20}, 1024, func(n, buffered, size int) {
+		sizes = append(sizes, size)
+	})
+	br.SetSoftLimit(32)
+	for _, expected := range []string{"a", strings.Repeat("b", 100), "c", "d"} {
+		line, err := br.ReadLine()
+		assert.NoError(err)
+		assert.Equal(expected, string(line))
+	}
+	_, err := br.ReadLine()
+	assert.Equal(io.EOF, err)
+	assert.Equal(32, sizes[0])
+	assert.Equal(128, slices.Max(sizes))
+	// shrunk back after the large line
+	assert.Equal(32, sizes[len(sizes)-1])
+}
+
+func TestMixedLineEndings(t *testing.T) {
+	assert := assert.New(t)
+	for _, c := range []struct {
+		input string
+		lines []string
+	}{
+		{"a\nb\r\nc\rd\r\ne", []string{"a", "b", "c", "d", "e"}},
+		// \r at the end of a fill followed by another \r is an empty line, not a part of \r\n
+		{"a\r\rb\r\r\nc", []string{"a", "", "b", "", "c"}},
+		{"a\r\n\rb\n\r\r\nc", []string{"a", "", "b", "", "", "c"}},
+	} {
+		assert.Equal(c.lines, readLines(t, iotest.OneByteReader(strings.NewReader(c.input))), "input: %q", c.input)
+	}
+
+	// random streams fed in random chunks
+	rng := rand.New(rand.NewPCG(1, 2))
+	endings := []string{"\n", "\r", "\r\n"}
+	for i := 0; i < 1000; i++ {
+		var sb strings.Builder
+		for j := rng.IntN(20); j > 0; j-- {
+			sb.WriteString(strings.Repeat("x", rng.IntN(3)))
+			sb.WriteString(endings[rng.IntN(len(endings))])
+		}
+		input := sb.String()
+		var chunks []int
+		for j := rng.IntN(len(input) + 1); j > 0; j-- {
+			chunks = append(chunks, 1+rng.IntN(3))
+		}
+		assert.Equal(splitLines(input), readLines(t, &chunkReader{data: input, chunks: chunks}), "input: %q, chunks: %v", input, chunks)
+	}
+}
+
+// emptyReadsReader returns no data and no error the given number of times, then reads the data.
+type emptyReadsReader struct {
+	empty int
+	r     io.Reader
+}
+
+func (r *emptyReadsReader) Read(p []byte) (int, error) {
+	if r.empty > 0 {
+		r.empty--
+		return 0, nil
+	}
+	return r.r.Read(p)
+}
+
+func TestMaxEmptyReads(t *testing.T) {
+	assert := assert.New(t)
+	br := New(&emptyReadsReader{150, strings.NewReader("foo\n")}, 4096)
+	_, err := br.ReadLine()
+	assert.Equal(io.ErrNoProgress, err)
+
+	br = New(&emptyReadsReader{150, strings.NewReader("foo\n")}, 4096)
+	br.SetMaxEmptyReads(200)
+	line, err := br.ReadLine()
+	assert.NoError(err)
+	assert.Equal("foo", string(line))
+}
@@ -0,0 +1,67 @@
+package buffer
+
+import (
+	"io"
+	"testing"
+)
+
+// splitLines is the reference implementation of the line splitting, the rest after the last line terminator (possibly
+// empty) is the last line.
+func splitLines(data string) []string {
+	var lines []string
+	for {
+		i := 0
+		for i < len(data) && data[i] != '\r' && data[i] != '\n' {
+			i++
+		}
+		lines = append(lines, data[:i])
+		if i == len(data) {
+			return lines
+		}
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			i++
+		}
+		data = data[i+1:]
+	}
+}
+
+func FuzzReadLine(f *testing.F) {
+	f.Add("data: foo\r\n\r\n", []byte{3, 1, 1}, uint8(1))
+	f.Add("a\r\n\r\nb", []byte{2, 1}, uint8(2))
+	f.Add("\r\r\n\n\r", []byte{1}, uint8(1))
+	f.Add("id: 1\nevent: foo\rdata: bar\r\n\n", []byte{}, uint8(16))
+	f.Fuzz(func(t *testing.T, data string, chunks []byte, initialSize uint8) {
+		var sizes []int
+		for _, c := range chunks {
+			sizes = append(sizes, int(c))
+		}
+		// small initial size exercises growing, the max size is big enough to never be reached
+		b := &ReadBuffer{
+			buf:     make([]byte, max(int(initialSize), 1)),
+			rd:      &chunkReader{data: data, chunks: sizes},
+			maxSize: len(data) + 1,
+		}
+		var lines []string
+		for {
+			line, err := b.ReadLine()
+			lines = append(lines, string(line))
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(lines) > len(data)+1 {
+				t.Fatalf("too many lines")
+			}
+		}
+		expected := splitLines(data)
+		if len(lines) != len(expected) {
+			t.Fatalf("got %d lines, expected %d: %q vs %q", len(lines), len(expected), lines, expected)
+		}
+		for i := range lines {
+			if lines[i] != expected[i] {
+				t.Fatalf("line %d is %q, expected %q", i, lines[i], expected[i])
+			}
+		}
+	})
+}
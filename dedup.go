@@ -0,0 +1,39 @@
+package eventsource
+
+// Suppresses dispatch of messages whose id was seen among the last windowSize dispatched messages. Handy for streams
+// which may redeliver the last event(s) after reconnect. Messages without id (or with empty id) are always dispatched.
+// Suppressed messages still update the last event ID.
+func WithDedup(windowSize int) Option {
+	return func(es *EventSource) {
+		if windowSize > 0 {
+			es.dedup = &idRing{ids: make([]string, windowSize)}
+		}
+	}
+}
+
+// Ring buffer of recently dispatched message ids.
+type idRing struct {
+	ids  []string
+	next int
+	full bool
+}
+
+// Reports whether the id was seen recently, otherwise remembers it.
+func (r *idRing) seenOrAdd(id []byte) bool {
+	n := r.next
+	if r.full {
+		n = len(r.ids)
+	}
+	for _, s := range r.ids[:n] {
+		if s == string(id) {
+			return true
+		}
+	}
+	r.ids[r.next] = string(id)
+	r.next++
+	if r.next == len(r.ids) {
+		r.next = 0
+		r.full = true
+	}
+	return false
+}
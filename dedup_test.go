@@ -0,0 +1,29 @@
+package eventsource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedup(t *testing.T) {
+	assert := assert.New(t)
+	cb, msgs := collect()
+	tr, ids := streamTransport(
+		"retry: 1\nid: 1\ndata: a\n\nid: 2\ndata: b\n\n\x00",
+		// the server resends the last event after reconnect
+		"id: 2\ndata: b\n\nid: 3\ndata: c\n\ndata: no id\n\ndata: no id\n\nid: 1\ndata: a\n\n",
+	)
+	es, err := New(WithTransport(tr), WithCallback(cb), WithDedup(2))
+	assert.NoError(err)
+	defer es.Close()
+	assert.Equal(result{id: "1", data: "a"}, receive(t, msgs))
+	assert.Equal(result{id: "2", data: "b"}, receive(t, msgs))
+	assert.Equal(result{id: "3", data: "c"}, receive(t, msgs))
+	assert.Equal(result{data: "no id"}, receive(t, msgs))
+	assert.Equal(result{data: "no id"}, receive(t, msgs))
+	// out of the window
+	assert.Equal(result{id: "1", data: "a"}, receive(t, msgs))
+	assert.Equal("", <-ids)
+	assert.Equal("2", <-ids)
+}
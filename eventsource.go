@@ -2,26 +2,124 @@ package eventsource
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/nsf/eventsource/buffer"
 	"io"
+	"iter"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // This error is delivered via callback when HTTP response contains a non-200 status. Use errors.Is to check for this error.
+// The actual error is *StatusError, use errors.As to get the details.
 var ErrInvalidStatus = errors.New("eventsource: http response status code is not 200")
 
+// StatusError is delivered via callback when HTTP response contains a non-200 status, it matches ErrInvalidStatus.
+// For 429 Too Many Requests and 503 Service Unavailable the "Retry-After" header is honored, its value is used as
+// the next reconnection delay.
+type StatusError struct {
+	StatusCode int
+	Status     string
+
+	// Copy of the response headers, e.g. "Retry-After", "WWW-Authenticate" or rate limit ones.
+	Header http.Header
+
+	// The beginning of the response body, see WithErrorBodyLimit. Nil by default.
+	Body []byte
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Body) > 0 {
+		return fmt.Sprintf("eventsource: http response status code is %d, body: %q", e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("eventsource: http response status code is %d", e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrInvalidStatus
+}
+
 // This error is delivered via callback when HTTP response contains Content-Type set to something else than "text/event-stream". Use errors.Is to check for this error.
 var ErrInvalidContentType = errors.New("eventsource: http response content type is not text/event-stream")
 
+// ContentTypeError is delivered via callback when HTTP response contains Content-Type set to something else than
+// "text/event-stream", it matches ErrInvalidContentType.
+type ContentTypeError struct {
+	ContentType string
+
+	// The beginning of the response body, see WithErrorBodyLimit. Nil by default. Usually reveals what the server
+	// actually sent, e.g. an HTML login page or a JSON error.
+	Body []byte
+}
+
+func (e *ContentTypeError) Error() string {
+	if len(e.Body) > 0 {
+		return fmt.Sprintf("eventsource: http response content type is %q, body: %q", e.ContentType, e.Body)
+	}
+	return fmt.Sprintf("eventsource: http response content type is %q", e.ContentType)
+}
+
+func (e *ContentTypeError) Unwrap() error {
+	return ErrInvalidContentType
+}
+
 // This error is delivered via callback when there was not enough space in the buffer while processing the message. Use errors.Is to check for this error.
 var ErrBufferFull = buffer.ErrBufferFull
 
+// This error is delivered via callback when a message has more "data" lines than allowed via WithMaxDataLines, the
+// message is dropped. Use errors.Is to check for this error.
+var ErrTooManyDataLines = errors.New("eventsource: too many data lines")
+
+// This error is delivered via callback when the server signals there is nothing more to stream, e.g. with one of
+// the statuses set via WithStopOnStatus. EventSource stops after that and never reconnects. Custom transports may
+// return it too. Use errors.Is to check for this error.
+var ErrStreamEnded = errors.New("eventsource: server ended the stream")
+
+// This error is delivered via callback when no message was dispatched within the timeout set via WithEventTimeout.
+// The connection is dropped and EventSource reconnects. Use errors.Is to check for this error.
+var ErrEventTimeout = errors.New("eventsource: no events received within timeout")
+
+// This error is delivered via callback when the connection doesn't use TLS of at least the version set via
+// WithMinTLSVersion. EventSource reconnects. Use errors.Is to check for this error.
+var ErrTLSVersion = errors.New("eventsource: TLS version is below the minimum")
+
+// This error is delivered via callback when a message has a field with unknown name and WithStrictFields is used.
+// The message is dropped. Use errors.Is to check for this error.
+var ErrUnknownField = errors.New("eventsource: unknown field")
+
+// This error is returned by Restart if EventSource is still running.
+var ErrNotStopped = errors.New("eventsource: not stopped")
+
+// This error is returned by the data reader of WithReaderCallback when the message turns out not to be dispatched
+// once it's complete: it's filtered out (see WithEventFilter), it's a duplicate (see WithDedup) or it's a reconnect
+// directive (see WithReconnectEventType). Use errors.Is to check for this error.
+var ErrMessageDiscarded = errors.New("eventsource: message discarded")
+
+// This error is delivered via callback when the handshake event set via WithHandshake wasn't received within the
+// timeout. The connection is dropped and EventSource reconnects. Use errors.Is to check for this error.
+var ErrHandshakeTimeout = errors.New("eventsource: no handshake event received within timeout")
+
+// This error is returned by methods waiting for something to happen, when EventSource stops (via Close or parent
+// context cancellation) before it did. Use errors.Is to check for this error.
+var ErrClosed = errors.New("eventsource: closed")
+
+// This error is returned by New when mutually exclusive options were used together. Use errors.Is to check for
+// this error.
+var ErrConflictingOptions = errors.New("eventsource: conflicting options")
+
 // Default maximum size of "id" field buffer.
 const DefaultMaxID = 256
 
@@ -36,7 +134,9 @@ type Message struct {
 	// When valid, this slice points to internal temporary buffer and might become invalid when callback returns.
 	ID []byte
 
-	// Type of the message. Corresponds to "event" field in SSE protocol. Nil if event did not provide the field.
+	// Type of the message. Corresponds to "event" field in SSE protocol. Empty if event did not provide the field or
+	// if the field is empty ("event:" or "event: "), both mean the default "message" type per spec. Empty may be nil or
+	// not, check the length, or normalize it via WithEmptyEventType.
 	// When valid, this slice points to internal temporary buffer and might become invalid when callback returns.
 	Event []byte
 
@@ -45,8 +145,42 @@ type Message struct {
 	// Copy the slice if you intend to handle the data later (and in many cases you want to do that to avoid
 	// stalling EventSource processing goroutine).
 	Data []byte
+
+	// Number of "data" lines the message was composed of. Only populated when WithDataLineCount is used.
+	DataLineCount int
+
+	// True if the message is not complete yet, only happens when WithPartialDispatch is used. Fields contain
+	// whatever was received so far.
+	Partial bool
+
+	// Number of the connection the message came from, starting from 1, incremented on every reconnect. Only
+	// populated when WithSequencing is used.
+	ConnectionGen uint64
+
+	// Number of the message within its connection, starting from 1. Only populated when WithSequencing is used.
+	SeqInConnection uint64
+
+	// True if the data exceeded BufferParameters.MaxData and it was cut at the limit, only happens when
+	// WithTruncateOversizedData is used.
+	Truncated bool
 }
 
+// How the empty event type of a message is represented. See: WithEmptyEventType.
+type EmptyEventType int
+
+const (
+	// Leave it as is, it may be nil or an empty slice. The default.
+	EmptyEventKeep EmptyEventType = iota
+
+	// Always nil.
+	EmptyEventNil
+
+	// The default type name, "message", as browsers do.
+	EmptyEventMessage
+)
+
+var defaultEventType = []byte("message")
+
 var (
 	knownFieldNameID    = []byte("id")
 	knownFieldNameEvent = []byte("event")
@@ -57,21 +191,171 @@ var (
 // Messages are delivered via this callback. See: WithCallback.
 type Callback func(msg Message, err error)
 
+// Data is delivered via this callback in chunks as it arrives, see: WithConsumingCallback. The msg.Data contains
+// the retained (not consumed) data of the previous call followed by the data of the new "data" line. Lines are
+// separated with "\n" as usual, thus concatenation of all consumed chunks is exactly the data of the message. The
+// final is true when the message is complete, unconsumed data of the final call is discarded. The callback returns
+// how many bytes of msg.Data were consumed. Errors are delivered with final set to true, return value is ignored.
+type ConsumingCallback func(msg Message, final bool, err error) (consumed int)
+
+// Diagnostics hook, called every time the read buffer reads from the stream with the number of bytes read, the
+// number of bytes buffered after the read and the current read buffer size. See: WithReadHook.
+type ReadHook func(n, buffered, size int)
+
+// Transport obtains the stream for a single connection attempt. The lastEventID contains the ID of the last
+// dispatched message which had the "id" field (empty if there was none). The returned reader is closed once the
+// stream ends. If the returned error matches context.Canceled, EventSource stops, any other error is delivered via
+// callback and the attempt is retried. See: WithTransport.
+type Transport func(ctx context.Context, lastEventID []byte) (io.ReadCloser, error)
+
 // EventSource
 type EventSource struct {
-	url          string
-	ctx          context.Context
-	cancel       func()
-	client       *http.Client
-	req          *http.Request
-	callback     Callback
-	bp           BufferParameters
-	wg           sync.WaitGroup
-	idBuf        []byte
-	eventBuf     []byte
-	dataBuf      []byte
-	msgErr       error
-	retryTimeout time.Duration
+	url                    string
+	ctx                    context.Context
+	cancel                 func()
+	client                 *http.Client
+	req                    *http.Request
+	transport              Transport
+	callback               atomic.Pointer[Callback]
+	consumer               ConsumingCallback
+	bp                     BufferParameters
+	wg                     sync.WaitGroup
+	done                   chan struct{}
+	attempt                int   // consecutive failed connection attempts
+	stopErr                error // the reason of stopping, valid once done is closed
+	connected              chan struct{}
+	wasConnected           bool
+	hasFields              bool // id, event or data field was seen in the current message
+	lastID                 []byte
+	hasID                  bool
+	idBuf                  []byte
+	eventBuf               []byte
+	dataBuf                []byte
+	dataLines              int
+	msgErr                 error
+	validateUTF8           bool
+	utf8Buf                []byte
+	noBodyDrain            bool
+	readHook               ReadHook
+	transform              func(val []byte) []byte
+	countLines             bool
+	panicHandler           func(recovered any)
+	dispatchIDOnly         bool
+	unixSocket             string
+	stopStatuses           []int
+	errorEvent             []byte
+	decodeError            func(data []byte) error
+	clientTrace            *httptrace.ClientTrace
+	commentCallback        func(comment []byte)
+	eventTimeout           time.Duration
+	commentsResetTimeout   bool
+	eventTimer             *time.Timer
+	connCtx                context.Context
+	recorder               io.Writer
+	batchCallback          BatchCallback
+	batchSize              int
+	batchDelay             time.Duration
+	batchMu                sync.Mutex
+	batch                  []Message
+	batchTimer             *time.Timer
+	batchBytes             int64
+	batchClosed            bool
+	partialDispatch        bool
+	maxPendingBytes        int64
+	retryPolicy            RetryPolicy
+	charsetDecoder         func(raw []byte) []byte
+	maxDataLines           int
+	backoffResetOn         BackoffResetMode
+	rawComments            bool
+	advanceIDOnDrop        bool
+	onRetry                func(attempt int, delay time.Duration, lastErr error)
+	rawDataStream          io.Writer
+	handshakeEvent         string
+	handshakeTimeout       time.Duration
+	handshakeTimer         *time.Timer
+	sequencing             bool
+	connGen                uint64 // number of the current connection
+	seq                    uint64 // number of messages dispatched within the current connection
+	skipContentTypeCheck   bool
+	readBufSize            int
+	queueSize              int
+	queuePolicy            QueueFullPolicy
+	queue                  chan queueItem
+	queueDone              chan struct{}
+	queueMu                sync.Mutex // guards queueBytes, it's released by the queue goroutine
+	queueBytes             int64      // size of queued messages and the one being handled, see WithMaxPendingBytes
+	queueFreed             chan struct{}
+	minReadChunk           int
+	minTLSVersion          uint16
+	dedup                  *idRing
+	idStore                IDStore
+	idSaveInterval         time.Duration
+	idMu                   sync.Mutex // guards the id store state below, it's accessed from the save timer as well
+	idPending              bool
+	pendingID              string
+	idSavedAt              time.Time
+	idSaveTimer            *time.Timer
+	idSaveErr              error
+	failFast               bool
+	cookieJar              http.CookieJar
+	slowCallbackThreshold  time.Duration
+	slowCallbackHandler    func(duration time.Duration)
+	strictFields           bool
+	newFramer              func(r io.Reader) Framer
+	paddingMinLen          int
+	parentCtx              context.Context // set via WithContext, es.ctx is derived from it
+	gotFirstEvent          chan struct{}
+	firstEvent             *Message
+	origin                 string
+	eventFilter            [][]byte
+	eventPrefixFilter      [][]byte
+	dispatchPartialOnError bool
+	readBufferSoftLimit    int
+	errorBodyLimit         int
+	priority               string
+	onIDReset              func(prev, cur int64)
+	suppressFirstLastID    bool
+	connectedAt            time.Time
+	reconnectLimiter       ReconnectLimiter
+	retryDeadline          time.Duration
+	failingSince           time.Time
+	spanStart              func(ctx context.Context, name string) (context.Context, func(error))
+	maxEmptyReads          int
+	truncateData           bool
+	truncated              bool
+	onRequest              func(req *http.Request)
+	emptyEventType         EmptyEventType
+	fallbackURLs           []string
+	fallbackAfter          int
+	urls                   []*url.URL
+	urlIndex               int
+	urlFailures            int
+	responseValidator      func(resp *http.Response) error
+	readerCallback         ReaderCallback
+	dataStream             *dataStream
+	reconnectEvent         string
+	reconnectRequested     bool
+	reconnectDelay         time.Duration
+	hasRetry               bool
+	msgRetry               time.Duration
+	cancelConn             context.CancelCauseFunc
+	disableKeepAlives      bool
+	wireCounted            bool        // the body counts bytes read itself, see gzipBody
+	jsonCallback           Callback    // decoding wrapper, see WithJSONFilter
+	readerErrs             []queueItem // delivered once the reader callback returns
+
+	bytesRead       atomic.Uint64
+	connBytesRead   atomic.Uint64
+	droppedMessages atomic.Uint64
+	mu              sync.Mutex // guards the fields below, they are accessed from other goroutines
+	retryTimeout    time.Duration
+	stats           BufferStats
+	remoteAddr      string
+	responseHeader  http.Header
+	contentLength   int64
+	tlsState        *tls.ConnectionState
+	allocated       int
+	firstEventDelay time.Duration
 }
 
 func growMaybeLimit(s []byte, reqCap, limit int) []byte {
@@ -106,10 +390,73 @@ func appendLimit(s []byte, ns []byte, limit int) ([]byte, error) {
 	}
 }
 
+// Like appendLimit, but whatever doesn't fit is cut off, reports whether it happened.
+func appendTruncate(s []byte, ns []byte, limit int) ([]byte, bool) {
+	if len(s) != 0 {
+		if len(s) >= limit {
+			return s, true
+		}
+		s = growMaybeLimit(s, len(s)+1+len(ns), limit)
+		s = append(s, '\n')
+	}
+	n := min(len(ns), limit-len(s))
+	s = growMaybeLimit(s, len(s)+n, limit)
+	s = append(s, ns[:n]...)
+	return s, n < len(ns)
+}
+
+func (es *EventSource) recoverCallbackPanic() {
+	if r := recover(); r != nil {
+		es.panicHandler(r)
+	}
+}
+
 func (es *EventSource) dispatch(msg Message, err error) {
-	if es.callback != nil {
-		es.callback(msg, err)
+	if es.slowCallbackHandler != nil {
+		start := time.Now()
+		defer func() {
+			if d := time.Since(start); d > es.slowCallbackThreshold {
+				es.slowCallbackHandler(d)
+			}
+		}()
+	}
+	if es.batchCallback != nil {
+		es.addToBatch(msg, err)
+	} else if es.consumer != nil {
+		es.consume(msg, true, err)
+	} else if es.readerCallback != nil {
+		es.dispatchReaderError(msg, err)
+	} else if es.queue != nil {
+		es.enqueue(msg, err)
+	} else {
+		es.callCallback(msg, err)
+	}
+}
+
+func (es *EventSource) callCallback(msg Message, err error) {
+	if callback := es.callback.Load(); callback != nil && *callback != nil {
+		if es.panicHandler != nil {
+			defer es.recoverCallbackPanic()
+		}
+		(*callback)(msg, err)
+	}
+}
+
+func (es *EventSource) comment(val []byte) {
+	if es.panicHandler != nil {
+		defer es.recoverCallbackPanic()
+	}
+	es.commentCallback(val)
+}
+
+// consume calls the consuming callback. If the callback panics and panics are recovered, all data is considered to
+// be consumed, there is no point in offering the same data again.
+func (es *EventSource) consume(msg Message, final bool, err error) (consumed int) {
+	if es.panicHandler != nil {
+		consumed = len(msg.Data)
+		defer es.recoverCallbackPanic()
 	}
+	return es.consumer(msg, final, err)
 }
 
 // Functions that return "Option" can be used with New when creating an EventSource.
@@ -139,6 +486,31 @@ type BufferParameters struct {
 	MaxReadBuffer int
 }
 
+// Returns a copy of bp with zero limits replaced by the defaults.
+func (bp BufferParameters) withDefaults() BufferParameters {
+	if bp.MaxID == 0 {
+		bp.MaxID = DefaultMaxID
+	}
+	if bp.MaxEvent == 0 {
+		bp.MaxEvent = DefaultMaxEvent
+	}
+	if bp.MaxData == 0 {
+		bp.MaxData = DefaultMaxData
+	}
+	if bp.MaxReadBuffer == 0 {
+		bp.MaxReadBuffer = max(bp.MaxID, bp.MaxEvent, bp.MaxData) + len("event: \r\n") + 1
+	}
+	return bp
+}
+
+// High-water marks of the buffers described in BufferParameters, in bytes. Useful to right-size the limits.
+type BufferStats struct {
+	ID         int
+	Event      int
+	Data       int
+	ReadBuffer int
+}
+
 // Overrides HTTP client used for making HTTP requests. The default is http.DefaultClient.
 func WithClient(cli *http.Client) Option {
 	return func(es *EventSource) {
@@ -153,6 +525,17 @@ func WithRequest(req *http.Request) Option {
 	}
 }
 
+// Overrides the way the stream is obtained. With a custom transport EventSource doesn't make HTTP requests at all,
+// the parsing pipeline consumes whatever reader the transport returns. This way SSE can be tunneled over a
+// non-HTTP transport, e.g. a WebSocket. The reader should fail once ctx is done, that's how Close stops it. When a
+// timeout drops the connection (see WithEventTimeout and WithHandshake), the reader is closed as well, so a blocked
+// Read must return on Close. Can't be used together with options related to HTTP (WithClient, WithRequest, WithURL).
+func WithTransport(t Transport) Option {
+	return func(es *EventSource) {
+		es.transport = t
+	}
+}
+
 func WithURL(url string) Option {
 	return func(es *EventSource) {
 		es.url = url
@@ -161,191 +544,1676 @@ func WithURL(url string) Option {
 
 func WithCallback(callback Callback) Option {
 	return func(es *EventSource) {
-		es.callback = callback
+		es.callback.Store(&callback)
 	}
 }
 
-func WithContext(ctx context.Context) Option {
+// Enables streaming of data, useful for incremental parsers. Instead of accumulating the whole message, data is
+// delivered to the callback line by line as it arrives. The callback decides how much of it to consume, the rest is
+// retained and prepended to the next chunk. The retained data and the new line must fit into MaxData together,
+// otherwise the message is dropped with ErrBufferFull error. Retained data never crosses message boundaries.
+// Can't be used together with WithCallback or WithUTF8Validation, nor with options which decide on the complete
+// message whether it's delivered (WithEventFilter, WithEventPrefixFilter, WithDedup and WithReconnectEventType), the
+// data is consumed by then.
+func WithConsumingCallback(callback ConsumingCallback) Option {
 	return func(es *EventSource) {
-		es.ctx = ctx
+		es.consumer = callback
 	}
 }
 
-func WithBufferParameters(bp BufferParameters) Option {
+// Disables draining of the response body when the connection ends. By default the remaining body is read till the
+// end, this way the underlying connection goes back to the http.Client's pool and can be reused. With this option
+// the body is closed right away, which is faster if there is a lot of data left, but the connection is not reused.
+func WithNoBodyDrain() Option {
 	return func(es *EventSource) {
-		es.bp = bp
+		es.noBodyDrain = true
 	}
 }
 
-func splitLine(line []byte) ([]byte, []byte) {
-	i := bytes.Index(line, []byte(`:`))
-	if i == -1 {
-		return line, nil
+// Makes the default transport capture up to n bytes of the body of a rejected response, they're available as Body of
+// StatusError and ContentTypeError, and they're shown in the error message. Helps to see at once that the server
+// returned e.g. an HTML login page instead of the stream. The rest of the body is drained as usual. 0 by default.
+func WithErrorBodyLimit(n int) Option {
+	return func(es *EventSource) {
+		es.errorBodyLimit = n
 	}
-	key := line[:i]
-	value := line[i+1:]
-	if i+1 < len(line) && line[i+1] == ' ' {
-		value = line[i+2:]
+}
+
+// Sets the diagnostics hook which observes low-level read activity. Helps to figure out why parsing stalls or why
+// ErrBufferFull happens. Nil by default.
+func WithReadHook(hook ReadHook) Option {
+	return func(es *EventSource) {
+		es.readHook = hook
 	}
-	return key, value
 }
 
-func (es *EventSource) perMessageReset() {
-	es.idBuf = es.idBuf[:0]
-	es.eventBuf = es.eventBuf[:0]
-	es.dataBuf = es.dataBuf[:0]
-	es.msgErr = nil
+// Sets the function applied to value of each "data" line before it's appended to message data. Can be used to
+// unwrap or decode (e.g. base64) data at parse time. The val points to the read buffer and is valid only until the
+// function returns. The returned slice is copied right away, thus it may reference val, a buffer owned by the caller
+// or a new allocation. Off by default.
+func WithDataTransform(transform func(val []byte) []byte) Option {
+	return func(es *EventSource) {
+		es.transform = transform
+	}
 }
 
-func (es *EventSource) perRequestReset() {
-	es.idBuf = nil
-	es.eventBuf = nil
-	es.dataBuf = nil
-	es.msgErr = nil
+// Enables population of Message.DataLineCount.
+func WithDataLineCount() Option {
+	return func(es *EventSource) {
+		es.countLines = true
+	}
 }
 
-func (es *EventSource) retryTimeoutSleep() {
-	time.Sleep(es.retryTimeout)
+// Recovers panics in callbacks. The handler is called with the recovered value and the stream continues as if the
+// callback returned normally. By default panics are not recovered, a buggy callback crashes the program, which is
+// usually what you want, masking bugs silently is not great. But for resilient services the opt-in is valuable.
+func WithRecoverCallbackPanics(handler func(recovered any)) Option {
+	return func(es *EventSource) {
+		es.panicHandler = handler
+	}
 }
 
-func (es *EventSource) processRequest() bool {
-	req := es.req.Clone(es.ctx)
-	if len(es.idBuf) != 0 {
-		req.Header.Set("Last-Event-Id", string(es.idBuf))
+// Enables dispatching of messages which have the "id" field, but no "data" field. Such messages are dispatched with
+// nil Event and Data, applications might use them as "cursor advanced" signals. By default, as the spec says,
+// messages without data are not dispatched (but the last event ID is updated anyway).
+func WithDispatchIDOnly() Option {
+	return func(es *EventSource) {
+		es.dispatchIDOnly = true
 	}
-	resp, err := es.client.Do(req)
-	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			// not an unexpected error
-			return false
-		}
-		es.dispatch(Message{}, fmt.Errorf("eventsource: http response error: %w", err))
-		return true
+}
+
+// Makes HTTP requests over the unix domain socket at the given path. The host part of the URL (see WithURL) is
+// ignored then, use anything as a placeholder, e.g. "http://unix/events". Can't be used together with WithClient,
+// since it's the client that knows how to dial, provide the client with a custom transport instead.
+func WithUnixSocket(path string) Option {
+	return func(es *EventSource) {
+		es.unixSocket = path
 	}
-	defer io.Copy(io.Discard, resp.Body)
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		es.dispatch(Message{}, ErrInvalidStatus)
-		return true
+// Sets HTTP response statuses which mean there is nothing more to stream. On such a status ErrStreamEnded is
+// delivered via callback and EventSource stops instead of reconnecting. Replaces the default set, which is 204
+// No Content. Use it without arguments to reconnect on any status.
+func WithStopOnStatus(codes ...int) Option {
+	return func(es *EventSource) {
+		es.stopStatuses = append([]int{}, codes...)
 	}
-	if resp.Header.Get("Content-Type") != "text/event-stream" {
-		es.dispatch(Message{}, ErrInvalidContentType)
-		return true
+}
+
+// Makes messages of the given event type (e.g. "error") surface as errors. For such messages the callback is
+// invoked with the error returned by decode, it receives the message data. If decode returns nil, the message is
+// dispatched as a normal one. If decode is nil, the data itself is used as the error text. This way application
+// errors sent by the server and transport errors are handled in the same place. Can't be used together with
+// WithConsumingCallback.
+func WithErrorEventType(name string, decode func(data []byte) error) Option {
+	return func(es *EventSource) {
+		es.errorEvent = []byte(name)
+		es.decodeError = decode
 	}
+}
 
-	// One might ask: "Why not reuse the buffers?". I think it's ok in this case to reset it on a per-request
-	// basis. The goal for Server-Sent Events is to serve lots of events through a single established
-	// connection. Thus connection shouldn't be normally broken. And if it happens, let's reset the buffers.
-	// Letting the GC do its job.
-	es.perRequestReset()
-	rb := buffer.New(resp.Body, es.bp.MaxReadBuffer)
-	for {
-		line, err := rb.ReadLine()
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				// not an unexpected error, signal we want to stop
-				return false
-			} else if errors.Is(err, io.EOF) {
-				// this could happen, but it means we should silently retry the request
-				return true
-			} else {
-				// otherwise report the error and retry the request
-				es.dispatch(Message{}, fmt.Errorf("eventsource: http response body read error: %w", err))
-				return true
-			}
-		}
-		if len(line) == 0 {
-			// empty line aka "\n\n", it separates events within a stream and acts as a "submit" signal
-			if es.msgErr == nil {
-				es.dispatch(Message{ID: es.idBuf, Event: es.eventBuf, Data: es.dataBuf}, nil)
-			} else {
-				es.dispatch(Message{}, es.msgErr)
-			}
-			es.perMessageReset()
-			continue
-		}
-		if es.msgErr != nil {
-			// when message error was set, we're skipping all other lines waiting for "submit" signal
-			continue
-		}
-		key, val := splitLine(line)
-		if len(key) == 0 {
-			// comment, skip it
-			continue
-		}
-		// handle all known fields
-		if bytes.Equal(key, knownFieldNameID) {
-			es.idBuf = es.idBuf[:0]
-			es.idBuf, err = appendLimit(es.idBuf, val, es.bp.MaxID)
-			if err != nil {
-				es.msgErr = fmt.Errorf("eventsource: id field is too long: %w", err)
-			}
-		} else if bytes.Equal(key, knownFieldNameEvent) {
-			es.eventBuf = es.eventBuf[:0]
-			es.eventBuf, err = appendLimit(es.eventBuf, val, es.bp.MaxEvent)
-			if err != nil {
-				es.msgErr = fmt.Errorf("eventsource: event field is too long: %w", err)
-			}
-		} else if bytes.Equal(key, knownFieldNameData) {
-			es.dataBuf, err = appendLimit(es.dataBuf, val, es.bp.MaxData)
-			if err != nil {
-				es.msgErr = fmt.Errorf("eventsource: data field is too long: %w", err)
-			}
-		} else if bytes.Equal(key, knownFieldNameRetry) {
-			ms, err := strconv.ParseInt(string(val), 10, 64)
-			if err == nil {
-				es.retryTimeout = time.Duration(ms) * time.Millisecond
-			}
-		}
+// Attaches the trace to every HTTP request, this way DNS, connect, TLS handshake and first byte timings of every
+// connection attempt can be observed. Can't be used together with WithTransport.
+func WithClientTrace(trace *httptrace.ClientTrace) Option {
+	return func(es *EventSource) {
+		es.clientTrace = trace
 	}
 }
 
-func New(options ...Option) (*EventSource, error) {
-	es := &EventSource{retryTimeout: 1 * time.Second}
-	es.wg.Add(1)
-	for _, opt := range options {
-		opt(es)
+// Sets the callback invoked for every comment line (the one which starts with a colon), including empty keep-alive
+// comments like ":". The comment is the text after the colon, with a single leading space removed, it points to
+// internal buffer and is valid only until the callback returns. Comments never affect messages.
+func WithCommentCallback(callback func(comment []byte)) Option {
+	return func(es *EventSource) {
+		es.commentCallback = callback
 	}
-	if es.req == nil {
-		var err error
-		es.req, err = http.NewRequest("GET", es.url, nil)
-		if err != nil {
-			return nil, err
-		}
+}
+
+// By default, when a message is dropped because of an error (e.g. ErrBufferFull), its id doesn't become the last event
+// ID, thus after reconnect the server can resend the dropped message. This option makes the id of a dropped message
+// advance the last event ID anyway, skipping the message for good. Only the id fields seen before the error count.
+func WithAdvanceIDOnDrop() Option {
+	return func(es *EventSource) {
+		es.advanceIDOnDrop = true
 	}
-	if es.client == nil {
-		es.client = http.DefaultClient
+}
+
+// Treats the stream as a single logical document: bytes of every data line are written to w as they arrive, with no
+// separators and no regard for event boundaries. Messages are not dispatched, the callback receives errors only. The id,
+// event and retry fields are still processed, reconnection works as usual. A write error drops the current message.
+func WithRawDataStream(w io.Writer) Option {
+	return func(es *EventSource) {
+		es.rawDataStream = w
 	}
-	if es.ctx == nil {
-		es.ctx = context.Background()
+}
+
+// Requires the connection to use TLS of at least the given version (e.g. tls.VersionTLS13). The default client is
+// configured to not negotiate lower versions. Responses are checked as well, it's the only way to enforce the policy
+// for a custom client (see WithClient). Connections which don't satisfy the requirement (including plaintext ones)
+// are rejected with ErrTLSVersion.
+func WithMinTLSVersion(v uint16) Option {
+	return func(es *EventSource) {
+		es.minTLSVersion = v
+	}
+}
+
+// Makes EventSource stop if the very first connection attempt fails (e.g. transport error, bad status or content
+// type), the error becomes the reason of stopping returned by WaitConnected. After the first successful connection,
+// reconnects happen as usual. Handy for startup health checks, see NewWithFirstConnect.
+func WithFailFast() Option {
+	return func(es *EventSource) {
+		es.failFast = true
 	}
-	if es.bp.MaxID == 0 {
-		es.bp.MaxID = DefaultMaxID
+}
+
+// Sets the cookie jar of the default client, cookies set by the server are sent back on reconnects. Useful for
+// session-authenticated streams. With a custom client (see WithClient) set the jar on the client instead.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(es *EventSource) {
+		es.cookieJar = jar
 	}
-	if es.bp.MaxEvent == 0 {
-		es.bp.MaxEvent = DefaultMaxEvent
+}
+
+// Sets the handler called when a callback call takes longer than the threshold, with the duration of the call. A slow
+// callback stalls the read loop, it's a way to notice that. The handler is called right after the slow callback
+// returns. For WithDispatchQueue it's the time spent waiting for room in the queue.
+func WithSlowCallbackThreshold(d time.Duration, handler func(duration time.Duration)) Option {
+	return func(es *EventSource) {
+		es.slowCallbackThreshold = d
+		es.slowCallbackHandler = handler
 	}
-	if es.bp.MaxData == 0 {
-		es.bp.MaxData = DefaultMaxData
+}
+
+// Makes fields with unknown names a protocol violation: the message is dropped and ErrUnknownField is delivered via
+// callback. By default such fields are ignored, as the spec says.
+func WithStrictFields() Option {
+	return func(es *EventSource) {
+		es.strictFields = true
 	}
-	if es.bp.MaxReadBuffer == 0 {
-		es.bp.MaxReadBuffer = max(es.bp.MaxID, es.bp.MaxEvent, es.bp.MaxData) + len("event: \r\n") + 1
+}
+
+// Sets the "Origin" header of requests, some servers reject requests without it (as non-browser ones). The same can be
+// done via WithRequest, this option is merely a shortcut.
+func WithOrigin(origin string) Option {
+	return func(es *EventSource) {
+		es.origin = origin
 	}
-	es.ctx, es.cancel = context.WithCancel(es.ctx)
-	go func() {
-		for es.processRequest() {
-			es.retryTimeoutSleep()
+}
+
+// Sets the priority hint of requests as defined by RFC 9218 (the "Priority" header), urgency is from 0 (highest) to 7
+// (lowest), it's clamped to that range, 3 is the default one. Incremental means the response can be processed in
+// parts, which is true for a stream. Lets the server or proxy deprioritize the stream relative to interactive requests
+// multiplexed over the same HTTP/2 or HTTP/3 connection, or vice versa. It's a hint, support depends on the server and
+// on intermediaries, Go's HTTP/2 transport doesn't send the deprecated PRIORITY frames.
+func WithPriority(urgency int, incremental bool) Option {
+	return func(es *EventSource) {
+		es.priority = fmt.Sprintf("u=%d", max(0, min(7, urgency)))
+		if incremental {
+			es.priority += ", i"
 		}
-		es.wg.Done()
-	}()
-	return es, nil
+	}
 }
 
-// Close forcefully and gracefully stops EventSource from receiving messages. It waits until internal goroutine returns.
-// Once Close() returns it's guaranteed that no callback calls will be made. After calling Close() the EventSource
-// cannot be reused and is left for garbage collection.
-func (es *EventSource) Close() {
-	es.cancel()
-	es.wg.Wait()
+// Accepts responses with any Content-Type (or none at all), ErrInvalidContentType is never reported. An escape hatch
+// for non-compliant servers, e.g. the ones which send "application/octet-stream".
+func WithSkipContentTypeCheck() Option {
+	return func(es *EventSource) {
+		es.skipContentTypeCheck = true
+	}
+}
+
+// Makes every read of the stream try to get at least n bytes, reading repeatedly if needed. Reduces the number of
+// syscalls when the server sends data in tiny chunks. Note that a message is not dispatched until n bytes are read
+// (or the stream ends), use it only for chatty streams, where the extra latency is small.
+func WithMinReadChunk(n int) Option {
+	return func(es *EventSource) {
+		es.minReadChunk = n
+	}
+}
+
+// Makes the comment callback skip comments longer than minLen which consist of whitespace only. Some servers send such
+// comments (e.g. 2KB of spaces) at the beginning of the stream to defeat proxy buffering, they are meaningless for
+// the application.
+func WithIgnorePaddingComments(minLen int) Option {
+	return func(es *EventSource) {
+		es.paddingMinLen = minLen
+	}
+}
+
+// When a message is dropped because of an error (e.g. ErrBufferFull), the error is delivered together with the fields
+// parsed successfully before it (e.g. the id), useful for logging the context of the dropped message. The field which
+// caused the error is nil, as well as the ones which were not parsed yet.
+func WithDispatchPartialOnError() Option {
+	return func(es *EventSource) {
+		es.dispatchPartialOnError = true
+	}
+}
+
+// Makes the read buffer shrink back to n bytes after it has grown beyond n to handle a large line (up to
+// BufferParameters.MaxReadBuffer), once the data it holds fits. Keeps steady-state memory low while tolerating bursts.
+func WithReadBufferSoftLimit(n int) Option {
+	return func(es *EventSource) {
+		es.readBufferSoftLimit = n
+	}
+}
+
+// Treats IDs as integers which must strictly increase, onReset is called when an ID is less than or equal to the
+// previous one, which usually means the server restarted and lost its position. The check survives reconnects and it
+// takes into account the initial last event ID (e.g. from WithIDStore). IDs which aren't integers are not checked.
+// The callback is called from the internal goroutine before the message is dispatched.
+func WithNumericIDCheck(onReset func(prev, cur int64)) Option {
+	return func(es *EventSource) {
+		es.onIDReset = onReset
+	}
+}
+
+// Makes the first connection go without the last event ID (the "Last-Event-Id" header of the default transport), even
+// if it was seeded (e.g. via WithIDStore). Some servers misbehave when a fresh connection carries an ID they don't
+// recognize. The ID is omitted until a connection is established, reconnects after that carry it as usual.
+func WithSuppressFirstLastEventID() Option {
+	return func(es *EventSource) {
+		es.suppressFirstLastID = true
+	}
+}
+
+// Sets the tracing hook, a way to integrate with OpenTelemetry or a similar library without depending on it. The start
+// is called before every connection attempt with the connection context and the span name, it returns the context
+// which carries the span (it must be derived from ctx) and the finish function. The returned context is used for the
+// request, this way HTTP client tracing links up. The finish is called once the connection is over with the error
+// which caused reconnection (nil if the stream simply ended or EventSource is closed). Both are called from the
+// internal goroutine.
+func WithSpanStart(start func(ctx context.Context, name string) (context.Context, func(error))) Option {
+	return func(es *EventSource) {
+		es.spanStart = start
+	}
+}
+
+// Sets how many consecutive reads returning no data are tolerated, 100 by default. E.g. a server sending zero-length
+// chunks without closing the stream may cause long runs of empty reads. Once the limit is reached, the connection is
+// considered stalled and EventSource silently reconnects, the same way as if the server closed the stream.
+func WithMaxEmptyReads(n int) Option {
+	return func(es *EventSource) {
+		es.maxEmptyReads = n
+	}
+}
+
+// Makes messages whose data exceeds BufferParameters.MaxData dispatched with the data cut at the limit and with
+// Message.Truncated set, instead of being dropped with ErrBufferFull. For consumers which tolerate partial data.
+// Can't be used together with WithConsumingCallback.
+func WithTruncateOversizedData() Option {
+	return func(es *EventSource) {
+		es.truncateData = true
+	}
+}
+
+// Sets the hook which receives the outgoing request of every connection attempt right before it's sent, with all the
+// headers set (e.g. "Last-Event-Id"). Handy for debugging auth and header issues across reconnects. The hook is for
+// inspection only, it must not modify the request, the prototype request can be set via WithRequest. Called from the
+// internal goroutine. Can't be used together with WithTransport.
+func WithOnRequest(onRequest func(req *http.Request)) Option {
+	return func(es *EventSource) {
+		es.onRequest = onRequest
+	}
+}
+
+// Normalizes the type of messages without "event" field or with an empty one, see EmptyEventType. Event filters (see
+// WithEventFilter) see the type before normalization, i.e. empty.
+func WithEmptyEventType(mode EmptyEventType) Option {
+	return func(es *EventSource) {
+		es.emptyEventType = mode
+	}
+}
+
+// Sets the custom acceptance check of responses, e.g. for servers which indicate errors in a header of a 200
+// response. The validator runs after the built-in checks (status and content type), a non-nil error rejects the
+// response: the error is delivered via callback (wrapped, use errors.Is or errors.As) and EventSource reconnects. The
+// validator must not read or close the body. Called from the internal goroutine. Can't be used together with
+// WithTransport.
+func WithResponseValidator(validator func(resp *http.Response) error) Option {
+	return func(es *EventSource) {
+		es.responseValidator = validator
+	}
+}
+
+// Sets the type of the event which is a server directive to reconnect right away, e.g. to rebalance connections.
+// Such an event drops the connection cleanly, without an error, and EventSource reconnects immediately, or after the
+// "retry" delay if the event has one (e.g. "event: reconnect\nretry: 500\n\n"). The retry policy is bypassed for
+// this reconnect. The event itself is not dispatched, the rest of the stream is ignored. Can't be used together
+// with WithPartialDispatch or WithConsumingCallback.
+func WithReconnectEventType(name string) Option {
+	return func(es *EventSource) {
+		es.reconnectEvent = name
+	}
+}
+
+// Disables reuse of HTTP connections, every connection attempt uses a fresh connection, which is closed once the
+// stream ends. The stream is long-lived, there is little point in returning its connection to the idle pool, and a
+// pooled connection may be half-broken after an outage. The tradeoff is an extra TCP (and TLS) handshake per
+// reconnect. Can't be used together with WithClient or WithTransport.
+func WithDisableKeepAlives() Option {
+	return func(es *EventSource) {
+		es.disableKeepAlives = true
+	}
+}
+
+// Makes the comment callback receive the exact text after the colon, the single leading space is not removed. E.g.
+// for ": hello" the comment is " hello" instead of "hello".
+func WithRawComments() Option {
+	return func(es *EventSource) {
+		es.rawComments = true
+	}
+}
+
+// Requires the server to send a message of the given event type within the timeout after connect. Otherwise the
+// connection is dropped, ErrHandshakeTimeout is delivered via callback and EventSource reconnects. The handshake message
+// is dispatched as usual (unless it has no data). Messages received before the handshake are dispatched too.
+func WithHandshake(eventType string, timeout time.Duration) Option {
+	return func(es *EventSource) {
+		es.handshakeEvent = eventType
+		es.handshakeTimeout = timeout
+	}
+}
+
+// Populates ConnectionGen and SeqInConnection fields of messages. Helps to correlate messages with reconnects in logs.
+func WithSequencing() Option {
+	return func(es *EventSource) {
+		es.sequencing = true
+	}
+}
+
+// Sets the maximum idle time between dispatched messages. If no message is dispatched within the timeout, the
+// connection is dropped, ErrEventTimeout is delivered via callback and EventSource reconnects. Unlike transport
+// timeouts it catches a server which keeps the connection alive, but whose event loop is stuck. If commentsCount is
+// true, comments (e.g. ":" keep-alives) reset the timeout as well. Zero (the default) disables the timeout.
+func WithEventTimeout(timeout time.Duration, commentsCount bool) Option {
+	return func(es *EventSource) {
+		es.eventTimeout = timeout
+		es.commentsResetTimeout = commentsCount
+	}
+}
+
+// Sets the reconnection delay which is used until the server provides its own via "retry" field. The default is 1s.
+func WithDefaultRetryTimeout(timeout time.Duration) Option {
+	return func(es *EventSource) {
+		es.retryTimeout = timeout
+	}
+}
+
+// Enables dispatching of incomplete messages for low-latency applications. Normally a message is dispatched when it's
+// complete, i.e. when the empty line is received. With this option the callback is also invoked after every "id",
+// "event" and "data" field with Message.Partial set to true and fields containing everything received so far (data
+// is accumulated, not delta). The complete message is dispatched as usual afterwards, with Message.Partial set to
+// false. Note that this violates normal event-boundary delivery: a partial message may never be completed (e.g.
+// connection breaks or a field is too long), the last event ID is only updated for complete messages. Can't be used
+// together with WithConsumingCallback, nor with options which decide on the complete message whether it's delivered
+// (WithEventFilter, WithEventPrefixFilter, WithDedup and WithReconnectEventType), the partial messages would leak.
+func WithPartialDispatch() Option {
+	return func(es *EventSource) {
+		es.partialDispatch = true
+	}
+}
+
+// Sets the decoder for servers which use a charset other than UTF-8 (non-compliant, but real). The decoder is applied
+// to each field value of a message (id, event, data) before dispatch, e.g. it can wrap a transformer from
+// golang.org/x/text/encoding. The raw value points to internal buffer, thus the decoder must not return it or its
+// sub-slice, it must copy. The returned slice may be reused by the decoder for the next value only after the callback
+// returns. Pass-through (UTF-8) by default. Can't be used together with WithConsumingCallback.
+func WithCharsetDecoder(decoder func(raw []byte) []byte) Option {
+	return func(es *EventSource) {
+		es.charsetDecoder = decoder
+	}
+}
+
+// Limits the number of "data" lines per message. A DoS safeguard: millions of tiny lines fit into MaxData just fine,
+// but cost a lot of CPU. Messages with more lines are dropped, ErrTooManyDataLines is delivered via callback instead.
+// Zero (the default) means no limit.
+func WithMaxDataLines(n int) Option {
+	return func(es *EventSource) {
+		es.maxDataLines = n
+	}
+}
+
+// Sets the context of EventSource, once it's done EventSource stops, like on Close. New returns an error if the context
+// is already done.
+func WithContext(ctx context.Context) Option {
+	return func(es *EventSource) {
+		es.ctx = ctx
+	}
+}
+
+func WithBufferParameters(bp BufferParameters) Option {
+	return func(es *EventSource) {
+		es.bp = bp
+	}
+}
+
+// Enables UTF-8 validation of message fields. Invalid sequences are replaced with U+FFFD before dispatch, the same
+// way browsers do it. Off by default, in that case fields contain raw bytes as they were sent by the server. When
+// replacement is necessary, the message fields point to yet another internal buffer, which is also limited by the
+// lifetime of the callback call.
+func WithUTF8Validation() Option {
+	return func(es *EventSource) {
+		es.validateUTF8 = true
+	}
+}
+
+// Splits the line into field name and value. As the spec says: the field name is everything before the first colon,
+// the value is everything after it, and if the value starts with a single U+0020 SPACE, exactly one space is removed.
+// If there is no colon, the whole line is the field name and the value is nil.
+func splitLine(line []byte) ([]byte, []byte) {
+	i := bytes.Index(line, []byte(`:`))
+	if i == -1 {
+		return line, nil
+	}
+	key := line[:i]
+	value := line[i+1:]
+	if i+1 < len(line) && line[i+1] == ' ' {
+		value = line[i+2:]
+	}
+	return key, value
+}
+
+func (es *EventSource) perMessageReset() {
+	es.hasFields = false
+	es.hasRetry = false
+	es.truncated = false
+	es.hasID = false
+	es.dataLines = 0
+	es.idBuf = es.idBuf[:0]
+	es.eventBuf = es.eventBuf[:0]
+	es.dataBuf = es.dataBuf[:0]
+	es.msgErr = nil
+}
+
+func (es *EventSource) perRequestReset() {
+	es.hasFields = false
+	es.hasRetry = false
+	es.truncated = false
+	es.hasID = false
+	es.dataLines = 0
+	es.idBuf = nil
+	es.eventBuf = nil
+	es.dataBuf = nil
+	es.msgErr = nil
+	es.readBufSize = 0
+	es.updateAllocated()
+}
+
+// Sleeps before the next connection attempt, the delay is decided by the retry policy. Returns false if EventSource
+// was closed in the meantime or if the policy gave up.
+func (es *EventSource) retrySleep(lastErr error) bool {
+	es.attempt++
+	delay, giveUp := es.retryPolicy.NextDelay(es.attempt, lastErr, es.RetryTimeout())
+	if es.failingSince.IsZero() {
+		es.failingSince = time.Now()
+	}
+	if es.retryDeadline > 0 && time.Since(es.failingSince) >= es.retryDeadline {
+		giveUp = true
+	}
+	if d, ok := retryAfter(lastErr); ok {
+		delay = d
+	}
+	if es.reconnectRequested {
+		es.reconnectRequested = false
+		delay = es.reconnectDelay
+	}
+	if giveUp {
+		err := ErrGaveUp
+		if lastErr != nil {
+			err = fmt.Errorf("%w: %w", ErrGaveUp, lastErr)
+		}
+		es.dispatch(Message{}, err)
+		es.stopErr = err
+		return false
+	}
+	if es.onRetry != nil {
+		es.onRetry(es.attempt, delay, lastErr)
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-es.ctx.Done():
+		return false
+	}
+}
+
+// Media types are case-insensitive and may have parameters (e.g. charset), mime.ParseMediaType takes care of that.
+func isEventStream(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// drainingBody drains the remaining response body before closing it, this way the connection can be reused.
+type drainingBody struct {
+	io.ReadCloser
+}
+
+func (b drainingBody) Close() error {
+	io.Copy(io.Discard, b.ReadCloser)
+	return b.ReadCloser.Close()
+}
+
+// gzipBody decompresses the response body, closing it closes the body as well.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// Reads the beginning of the rejected response body for the error, see WithErrorBodyLimit.
+func (es *EventSource) readErrorBody(ctx context.Context, resp *http.Response) []byte {
+	if es.errorBodyLimit <= 0 {
+		return nil
+	}
+	// the body may be slow or endless, the read must not outlive the connection
+	stop := context.AfterFunc(ctx, func() {
+		resp.Body.Close()
+	})
+	defer stop()
+	var body io.Reader = resp.Body
+	if needsGunzip(resp) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil
+		}
+		body = gz
+	}
+	b, _ := io.ReadAll(io.LimitReader(body, int64(es.errorBodyLimit)))
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
+// When the request prototype sets "Accept-Encoding" manually, http.Transport doesn't decompress the body
+// (resp.Uncompressed is false and "Content-Encoding" is kept), we have to do it ourselves then.
+func needsGunzip(resp *http.Response) bool {
+	return !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+}
+
+// The default transport, makes HTTP request and validates the response.
+func (es *EventSource) httpTransport(ctx context.Context, lastEventID []byte) (io.ReadCloser, error) {
+	if es.clientTrace != nil {
+		ctx = httptrace.WithClientTrace(ctx, es.clientTrace)
+	}
+	// httptrace merges hooks, the user's trace is called as well
+	var remoteAddr string
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn != nil && info.Conn.RemoteAddr() != nil {
+				remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+	})
+	req := es.req.Clone(ctx)
+	if es.urlIndex != 0 {
+		req.URL = es.urls[es.urlIndex]
+		// the Host of the prototype belongs to the primary URL
+		req.Host = ""
+	}
+	if len(lastEventID) != 0 {
+		req.Header.Set("Last-Event-Id", string(lastEventID))
+	}
+	if es.origin != "" {
+		req.Header.Set("Origin", es.origin)
+	}
+	if es.priority != "" {
+		req.Header.Set("Priority", es.priority)
+	}
+	if es.onRequest != nil {
+		es.onRequest(req)
+	}
+	resp, err := es.client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			// not an unexpected error
+			return nil, err
+		}
+		return nil, fmt.Errorf("eventsource: http response error: %w", err)
+	}
+	var body io.ReadCloser = drainingBody{resp.Body}
+	if es.noBodyDrain {
+		body = resp.Body
+	}
+	if resp.StatusCode != http.StatusOK {
+		errBody := es.readErrorBody(ctx, resp)
+		body.Close()
+		if slices.Contains(es.stopStatuses, resp.StatusCode) {
+			return nil, fmt.Errorf("%w: http response status code is %d", ErrStreamEnded, resp.StatusCode)
+		}
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Header: resp.Header.Clone(), Body: errBody}
+	}
+	if es.minTLSVersion != 0 && (resp.TLS == nil || resp.TLS.Version < es.minTLSVersion) {
+		// don't drain, we don't want to talk to this server and the stream may be endless
+		resp.Body.Close()
+		return nil, ErrTLSVersion
+	}
+	if !es.skipContentTypeCheck && !isEventStream(resp.Header.Get("Content-Type")) {
+		errBody := es.readErrorBody(ctx, resp)
+		body.Close()
+		return nil, &ContentTypeError{ContentType: resp.Header.Get("Content-Type"), Body: errBody}
+	}
+	if es.responseValidator != nil {
+		if err := es.responseValidator(resp); err != nil {
+			// don't drain, the response looks like a stream, it may be endless
+			resp.Body.Close()
+			return nil, fmt.Errorf("eventsource: response rejected: %w", err)
+		}
+	}
+	es.mu.Lock()
+	es.remoteAddr = remoteAddr
+	es.responseHeader = resp.Header
+	es.contentLength = resp.ContentLength
+	es.tlsState = resp.TLS
+	es.mu.Unlock()
+	// Content-Type describes the decompressed stream
+	if needsGunzip(resp) {
+		// bytes are counted as they come over the wire, before decompression
+		gz, err := gzip.NewReader(byteCounter{body, es})
+		if err != nil {
+			body.Close()
+			if errors.Is(err, context.Canceled) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("eventsource: gzip error: %w", err)
+		}
+		return gzipBody{gz, body}, nil
+	}
+	return body, nil
+}
+
+// processRequest makes a single connection attempt and processes the stream. Returns false if EventSource should
+// stop, otherwise the error which caused reconnection (nil if the stream simply ended).
+func (es *EventSource) processRequest() (retry bool, err error) {
+	// connection context, cancelled with a cause when we drop the connection on purpose
+	ctx, cancel := context.WithCancelCause(es.ctx)
+	defer cancel(nil)
+	es.connCtx = ctx
+	es.cancelConn = cancel
+	es.connBytesRead.Store(0)
+	reqCtx := ctx
+	if es.spanStart != nil {
+		var finish func(error)
+		reqCtx, finish = es.spanStart(ctx, "eventsource.connection")
+		defer func() {
+			finish(err)
+		}()
+	}
+	lastID := es.lastID
+	if es.suppressFirstLastID && !es.wasConnected {
+		lastID = nil
+	}
+	if es.reconnectLimiter != nil && es.attempt > 0 {
+		if err := es.reconnectLimiter.Acquire(ctx); err != nil {
+			return false, nil
+		}
+	}
+	body, err := es.transport(reqCtx, lastID)
+	if es.reconnectLimiter != nil && es.attempt > 0 {
+		es.reconnectLimiter.Release()
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			// not an unexpected error
+			return false, nil
+		}
+		es.dispatch(Message{}, err)
+		if errors.Is(err, ErrStreamEnded) {
+			es.stopErr = err
+			return false, nil
+		}
+		es.connectFailed()
+		return true, err
+	}
+	// the body may ignore ctx (e.g. the one of a custom transport), timeouts close it to unblock the read
+	closeBody := sync.OnceValue(body.Close)
+	defer closeBody()
+	// the compressed body was counted by the transport already
+	_, es.wireCounted = body.(gzipBody)
+	if es.recorder != nil {
+		body = recorder{io.TeeReader(body, es.recorder), body}
+	}
+	es.connectionSucceeded(BackoffResetOnConnect)
+	es.failingSince = time.Time{}
+	es.urlFailures = 0
+	es.connGen++
+	es.seq = 0
+	es.connectedAt = time.Now()
+	es.mu.Lock()
+	es.firstEventDelay = 0
+	es.mu.Unlock()
+	if !es.wasConnected {
+		es.wasConnected = true
+		close(es.connected)
+	}
+	if es.eventTimeout > 0 {
+		es.eventTimer = time.AfterFunc(es.eventTimeout, func() {
+			cancel(ErrEventTimeout)
+			closeBody()
+		})
+		defer func() {
+			es.eventTimer.Stop()
+			es.eventTimer = nil
+		}()
+	}
+	if es.handshakeTimeout > 0 {
+		es.handshakeTimer = time.AfterFunc(es.handshakeTimeout, func() {
+			cancel(ErrHandshakeTimeout)
+			closeBody()
+		})
+		defer func() {
+			if es.handshakeTimer != nil {
+				es.handshakeTimer.Stop()
+				es.handshakeTimer = nil
+			}
+		}()
+	}
+	return es.processStream(body)
+}
+
+func (es *EventSource) message() Message {
+	var id []byte
+	if es.hasID {
+		id = es.idBuf
+	}
+	event := es.eventBuf
+	if len(event) == 0 {
+		switch es.emptyEventType {
+		case EmptyEventNil:
+			event = nil
+		case EmptyEventMessage:
+			// the buffer is empty anyway, it's reused to avoid sharing a global slice
+			event = append(es.eventBuf[:0], defaultEventType...)
+		}
+	}
+	msg := Message{ID: id, Event: event, Data: es.dataBuf, Truncated: es.truncated}
+	if es.countLines {
+		msg.DataLineCount = es.dataLines
+	}
+	if es.sequencing {
+		msg.ConnectionGen = es.connGen
+		msg.SeqInConnection = es.seq + 1
+	}
+	return msg
+}
+
+// submit dispatches the current message and prepares for the next one.
+func (es *EventSource) submit() {
+	if es.msgErr != nil {
+		if es.advanceIDOnDrop && es.hasID {
+			es.setLastID(es.idBuf)
+		}
+		var msg Message
+		if es.dispatchPartialOnError {
+			msg = es.message()
+		}
+		es.dispatch(msg, es.msgErr)
+		es.perMessageReset()
+		return
+	}
+	if es.hasID {
+		if es.onIDReset != nil {
+			es.checkNumericID()
+		}
+		es.setLastID(es.idBuf)
+	}
+	if es.hasFields {
+		es.connectionSucceeded(BackoffResetOnFirstEvent)
+	}
+	if es.handshakeTimer != nil && string(es.eventBuf) == es.handshakeEvent {
+		es.handshakeTimer.Stop()
+		es.handshakeTimer = nil
+	}
+	if es.reconnectEvent != "" && string(es.eventBuf) == es.reconnectEvent {
+		// a directive, not a message
+		es.reconnectRequested = true
+		es.reconnectDelay = 0
+		if es.hasRetry {
+			es.reconnectDelay = es.msgRetry
+		}
+		es.discardMessage()
+		return
+	}
+	if !es.eventAllowed() {
+		es.discardMessage()
+		return
+	}
+	msg := es.message()
+	if es.dedup != nil && len(es.idBuf) != 0 && (es.dataLines != 0 || es.dispatchIDOnly) && es.dedup.seenOrAdd(es.idBuf) {
+		// recently seen, suppress the duplicate
+		es.discardMessage()
+		return
+	}
+	if es.dataLines == 0 {
+		// as the spec says, messages without data are not dispatched, unless the user wants to see id-only ones
+		if es.dispatchIDOnly && es.hasID {
+			es.dispatchMessage(Message{ID: msg.ID, ConnectionGen: msg.ConnectionGen, SeqInConnection: msg.SeqInConnection})
+			es.seq++
+		}
+	} else {
+		es.connectionSucceeded(BackoffResetOnFirstData)
+		es.dispatchMessage(msg)
+		es.seq++
+	}
+	es.perMessageReset()
+}
+
+// Drops the current message without dispatching it. The data may be streamed to the reader callback already, it's
+// completed with an error then, otherwise it would go on with the data of the next message.
+func (es *EventSource) discardMessage() {
+	es.finishDataStream(ErrMessageDiscarded)
+	es.perMessageReset()
+}
+
+// Calls the WithNumericIDCheck callback if the new ID doesn't increase the last one, non-numeric IDs are skipped.
+func (es *EventSource) checkNumericID() {
+	prev, err := strconv.ParseInt(string(es.lastID), 10, 64)
+	if err != nil {
+		return
+	}
+	cur, err := strconv.ParseInt(string(es.idBuf), 10, 64)
+	if err != nil {
+		return
+	}
+	if cur <= prev {
+		es.onIDReset(prev, cur)
+	}
+}
+
+// Resets the attempts counter (and thus the backoff) if the connection success criteria is met.
+func (es *EventSource) connectionSucceeded(mode BackoffResetMode) {
+	if es.backoffResetOn == mode {
+		es.attempt = 0
+	}
+}
+
+// Applies charset decoder and UTF-8 validation to message fields.
+func (es *EventSource) decode(msg Message) Message {
+	if es.charsetDecoder != nil {
+		if msg.ID != nil {
+			msg.ID = es.charsetDecoder(msg.ID)
+		}
+		if msg.Event != nil {
+			msg.Event = es.charsetDecoder(msg.Event)
+		}
+		if msg.Data != nil {
+			msg.Data = es.charsetDecoder(msg.Data)
+		}
+	}
+	if es.validateUTF8 {
+		msg = es.replaceInvalidUTF8(msg)
+	}
+	return msg
+}
+
+// Dispatches the incomplete message, see: WithPartialDispatch.
+func (es *EventSource) dispatchPartial() {
+	if !es.partialDispatch || es.msgErr != nil {
+		return
+	}
+	msg := es.message()
+	msg.Partial = true
+	es.dispatch(es.decode(msg), nil)
+}
+
+// Resets the event timeout, see: WithEventTimeout.
+func (es *EventSource) resetEventTimer() {
+	if es.eventTimer != nil {
+		es.eventTimer.Reset(es.eventTimeout)
+	}
+}
+
+func (es *EventSource) dispatchMessage(msg Message) {
+	es.resetEventTimer()
+	if es.seq == 0 && !es.connectedAt.IsZero() {
+		es.mu.Lock()
+		es.firstEventDelay = time.Since(es.connectedAt)
+		es.mu.Unlock()
+	}
+	if es.consumer != nil {
+		es.firstEventReceived(msg)
+		es.consume(msg, true, nil)
+		return
+	}
+	if es.readerCallback != nil {
+		es.firstEventReceived(msg)
+		es.dispatchReader(msg)
+		return
+	}
+	msg = es.decode(msg)
+	if es.errorEvent != nil && bytes.Equal(msg.Event, es.errorEvent) {
+		var err error
+		if es.decodeError != nil {
+			err = es.decodeError(msg.Data)
+		} else {
+			err = errors.New(string(msg.Data))
+		}
+		if err != nil {
+			es.dispatch(Message{}, err)
+			return
+		}
+	}
+	es.firstEventReceived(msg)
+	es.dispatch(msg, nil)
+}
+
+// Remembers the first message, see WaitForEvent.
+func (es *EventSource) firstEventReceived(msg Message) {
+	if es.firstEvent != nil || es.gotFirstEvent == nil {
+		// already received or it's a parser
+		return
+	}
+	first := msg.Clone()
+	es.firstEvent = &first
+	close(es.gotFirstEvent)
+}
+
+// consumeData appends the data line to the retained data and lets the consuming callback take as much as it wants.
+func (es *EventSource) consumeData(val []byte) error {
+	nlen := len(es.dataBuf) + len(val)
+	if es.dataLines != 0 {
+		nlen++
+	}
+	if nlen > es.bp.MaxData {
+		return ErrBufferFull
+	}
+	es.dataBuf = growMaybeLimit(es.dataBuf, nlen, es.bp.MaxData)
+	if es.dataLines != 0 {
+		es.dataBuf = append(es.dataBuf, '\n')
+	}
+	es.dataBuf = append(es.dataBuf, val...)
+	es.updatePeak(&es.stats.Data, len(es.dataBuf))
+	es.updateAllocated()
+	msg := es.message()
+	if es.countLines {
+		// the line being consumed is counted by the caller afterwards
+		msg.DataLineCount++
+	}
+	consumed := es.consume(msg, false, nil)
+	consumed = min(max(consumed, 0), len(es.dataBuf))
+	es.dataBuf = es.dataBuf[:copy(es.dataBuf, es.dataBuf[consumed:])]
+	return nil
+}
+
+// Peaks are only written by the internal goroutine, hence it can read them without locking.
+func (es *EventSource) updatePeak(peak *int, n int) {
+	if n > *peak {
+		es.mu.Lock()
+		*peak = n
+		es.mu.Unlock()
+	}
+}
+
+// Allocated bytes are only written by the internal goroutine, hence it can read them without locking.
+func (es *EventSource) updateAllocated() {
+	n := cap(es.idBuf) + cap(es.eventBuf) + cap(es.dataBuf) + es.readBufSize
+	if n != es.allocated {
+		es.mu.Lock()
+		es.allocated = n
+		es.mu.Unlock()
+	}
+}
+
+// Reports whether the comment is anti-buffering padding, see WithIgnorePaddingComments.
+func (es *EventSource) isPadding(comment []byte) bool {
+	return es.paddingMinLen > 0 && len(comment) > es.paddingMinLen && len(bytes.TrimLeft(comment, " \t")) == 0
+}
+
+// Called by the read buffer on each fill.
+func (es *EventSource) fillHook(n, buffered, size int) {
+	if !es.wireCounted {
+		es.addBytesRead(n)
+	}
+	es.updatePeak(&es.stats.ReadBuffer, size)
+	es.readBufSize = size
+	es.updateAllocated()
+	if es.readHook != nil {
+		es.readHook(n, buffered, size)
+	}
+}
+
+// processStream parses the stream and dispatches messages until the stream ends. Returns false if EventSource
+// should stop, otherwise the error which caused reconnection (nil if the stream simply ended).
+func (es *EventSource) processStream(r io.Reader) (bool, error) {
+	// One might ask: "Why not reuse the buffers?". I think it's ok in this case to reset it on a per-request
+	// basis. The goal for Server-Sent Events is to serve lots of events through a single established
+	// connection. Thus connection shouldn't be normally broken. And if it happens, let's reset the buffers.
+	// Letting the GC do its job.
+	es.perRequestReset()
+	if es.readerCallback != nil {
+		// the connection is over, the message can't be completed
+		defer es.finishDataStream(io.ErrUnexpectedEOF)
+	}
+	if es.newFramer != nil {
+		if !es.wireCounted {
+			r = byteCounter{r, es}
+		}
+		return es.processFrames(es.newFramer(r))
+	}
+	rb := buffer.NewWithHook(r, es.bp.MaxReadBuffer, es.fillHook)
+	rb.SetMinReadChunk(es.minReadChunk)
+	rb.SetMaxEmptyReads(es.maxEmptyReads)
+	rb.SetSoftLimit(es.readBufferSoftLimit)
+	for {
+		line, err := rb.ReadLine()
+		if err != nil {
+			return es.readError(err)
+		}
+		es.processLine(line)
+		if es.reconnectRequested {
+			return es.reconnectNow()
+		}
+	}
+}
+
+// Drops the connection right away as the server asked (see WithReconnectEventType), returns values for
+// processStream. The connection is cancelled, otherwise closing the body would drain the stream.
+func (es *EventSource) reconnectNow() (bool, error) {
+	es.cancelConn(nil)
+	return true, nil
+}
+
+// Handles an error of reading the stream, returns values for processStream.
+func (es *EventSource) readError(err error) (bool, error) {
+	if es.connCtx.Err() != nil && es.ctx.Err() == nil {
+		// the connection was dropped on purpose, report the reason and reconnect
+		err = context.Cause(es.connCtx)
+		es.dispatch(Message{}, err)
+		return true, err
+	} else if errors.Is(err, context.Canceled) {
+		// not an unexpected error, signal we want to stop
+		return false, nil
+	} else if errors.Is(err, io.EOF) || errors.Is(err, io.ErrNoProgress) {
+		// this could happen, but it means we should silently retry the request, the server stalling with empty reads
+		// is no different from the server closing the stream
+		return true, nil
+	} else {
+		// otherwise report the error and retry the request
+		err = fmt.Errorf("eventsource: http response body read error: %w", err)
+		es.dispatch(Message{}, err)
+		return true, err
+	}
+}
+
+// processLine handles a single line of the stream.
+func (es *EventSource) processLine(line []byte) {
+	if len(line) == 0 {
+		// empty line aka "\n\n", it separates events within a stream and acts as a "submit" signal
+		es.submit()
+		return
+	}
+	if es.msgErr != nil {
+		// when message error was set, we're skipping all other lines waiting for "submit" signal
+		return
+	}
+	if line[0] == ':' {
+		// fast path for comments (keep-alives mostly), no need to search for the colon
+		val := line[1:]
+		if !es.rawComments && len(val) > 0 && val[0] == ' ' {
+			// comments aren't fields, but with raw comments the leading space may be meaningful
+			val = val[1:]
+		}
+		es.processField(nil, val)
+		return
+	}
+	key, val := splitLine(line)
+	es.processField(key, val)
+}
+
+// processField handles a single field of the current message, empty key means comment.
+func (es *EventSource) processField(key, val []byte) {
+	if len(key) == 0 {
+		// comment, e.g. ":" keep-alive, doesn't affect the message
+		if es.commentCallback != nil && !es.isPadding(val) {
+			es.comment(val)
+		}
+		if es.commentsResetTimeout {
+			es.resetEventTimer()
+		}
+		return
+	}
+	// handle all known fields
+	var err error
+	if bytes.Equal(key, knownFieldNameID) {
+		if bytes.IndexByte(val, 0) != -1 {
+			// per spec, id containing NULL is ignored entirely
+			return
+		}
+		es.hasFields = true
+		es.hasID = true
+		es.idBuf = es.idBuf[:0]
+		es.idBuf, err = appendLimit(es.idBuf, val, es.bp.MaxID)
+		if err != nil {
+			// the id is unusable, it never becomes the last event ID
+			es.hasID = false
+			es.msgErr = fmt.Errorf("eventsource: id field is too long: %w", err)
+		}
+		es.updatePeak(&es.stats.ID, len(es.idBuf))
+		es.updateAllocated()
+		es.dispatchPartial()
+	} else if bytes.Equal(key, knownFieldNameEvent) {
+		es.hasFields = true
+		es.eventBuf = es.eventBuf[:0]
+		es.eventBuf, err = appendLimit(es.eventBuf, val, es.bp.MaxEvent)
+		if err != nil {
+			es.msgErr = fmt.Errorf("eventsource: event field is too long: %w", err)
+		}
+		es.updatePeak(&es.stats.Event, len(es.eventBuf))
+		es.updateAllocated()
+		es.dispatchPartial()
+	} else if bytes.Equal(key, knownFieldNameData) {
+		es.hasFields = true
+		if es.maxDataLines > 0 && es.dataLines >= es.maxDataLines {
+			es.msgErr = ErrTooManyDataLines
+			return
+		}
+		if es.transform != nil {
+			val = es.transform(val)
+		}
+		if es.rawDataStream != nil {
+			// data goes straight to the writer, there are no messages to dispatch
+			if _, err := es.rawDataStream.Write(val); err != nil {
+				es.msgErr = fmt.Errorf("eventsource: raw data stream write error: %w", err)
+			}
+			es.connectionSucceeded(BackoffResetOnFirstData)
+			return
+		}
+		if es.consumer != nil {
+			err = es.consumeData(val)
+		} else if es.readerCallback != nil {
+			es.streamData(val)
+		} else {
+			if es.truncateData {
+				var truncated bool
+				es.dataBuf, truncated = appendTruncate(es.dataBuf, val, es.bp.MaxData)
+				es.truncated = es.truncated || truncated
+			} else {
+				es.dataBuf, err = appendLimit(es.dataBuf, val, es.bp.MaxData)
+			}
+			es.updatePeak(&es.stats.Data, len(es.dataBuf))
+			es.updateAllocated()
+		}
+		es.dataLines++
+		if err != nil {
+			es.msgErr = fmt.Errorf("eventsource: data field is too long: %w", err)
+		}
+		es.dispatchPartial()
+	} else if bytes.Equal(key, knownFieldNameRetry) {
+		ms, err := strconv.ParseInt(string(val), 10, 64)
+		if err == nil {
+			es.mu.Lock()
+			es.retryTimeout = time.Duration(ms) * time.Millisecond
+			es.mu.Unlock()
+			es.hasRetry = true
+			es.msgRetry = time.Duration(ms) * time.Millisecond
+		}
+	} else if es.strictFields {
+		es.msgErr = fmt.Errorf("%w: %q", ErrUnknownField, key)
+	}
+}
+
+// Returns an error if mutually exclusive options were used together. Instead of silently picking one of them, we
+// let the user know.
+func (es *EventSource) validateOptions() error {
+	conflicts := []struct {
+		a, b     string
+		conflict bool
+	}{
+		{"WithURL", "WithRequest", es.url != "" && es.req != nil},
+		{"WithTransport", "WithURL", es.transport != nil && es.url != ""},
+		{"WithTransport", "WithRequest", es.transport != nil && es.req != nil},
+		{"WithTransport", "WithClient", es.transport != nil && es.client != nil},
+		{"WithTransport", "WithClientTrace", es.transport != nil && es.clientTrace != nil},
+		{"WithTransport", "WithMinTLSVersion", es.transport != nil && es.minTLSVersion != 0},
+		{"WithTransport", "WithCookieJar", es.transport != nil && es.cookieJar != nil},
+		{"WithClient", "WithCookieJar", es.client != nil && es.cookieJar != nil},
+		{"WithTransport", "WithDisableKeepAlives", es.transport != nil && es.disableKeepAlives},
+		{"WithClient", "WithDisableKeepAlives", es.client != nil && es.disableKeepAlives},
+		{"WithTransport", "WithFallbackURLs", es.transport != nil && es.fallbackURLs != nil},
+		{"WithTransport", "WithResponseValidator", es.transport != nil && es.responseValidator != nil},
+		{"WithTransport", "WithOnRequest", es.transport != nil && es.onRequest != nil},
+		{"WithTransport", "WithOrigin", es.transport != nil && es.origin != ""},
+		{"WithTransport", "WithPriority", es.transport != nil && es.priority != ""},
+		{"WithTransport", "WithErrorBodyLimit", es.transport != nil && es.errorBodyLimit != 0},
+		{"WithTransport", "WithSkipContentTypeCheck", es.transport != nil && es.skipContentTypeCheck},
+		{"WithUnixSocket", "WithClient", es.unixSocket != "" && es.client != nil},
+		{"WithUnixSocket", "WithTransport", es.unixSocket != "" && es.transport != nil},
+		{"WithConsumingCallback", "WithCallback", es.consumer != nil && es.callback.Load() != nil},
+		{"WithConsumingCallback", "WithUTF8Validation", es.consumer != nil && es.validateUTF8},
+		{"WithConsumingCallback", "WithCharsetDecoder", es.consumer != nil && es.charsetDecoder != nil},
+		{"WithConsumingCallback", "WithPartialDispatch", es.consumer != nil && es.partialDispatch},
+		{"WithConsumingCallback", "WithEventFilter", es.consumer != nil && es.eventFilter != nil},
+		{"WithConsumingCallback", "WithEventPrefixFilter", es.consumer != nil && es.eventPrefixFilter != nil},
+		{"WithConsumingCallback", "WithDedup", es.consumer != nil && es.dedup != nil},
+		{"WithConsumingCallback", "WithReconnectEventType", es.consumer != nil && es.reconnectEvent != ""},
+		{"WithPartialDispatch", "WithEventFilter", es.partialDispatch && es.eventFilter != nil},
+		{"WithPartialDispatch", "WithEventPrefixFilter", es.partialDispatch && es.eventPrefixFilter != nil},
+		{"WithPartialDispatch", "WithDedup", es.partialDispatch && es.dedup != nil},
+		{"WithPartialDispatch", "WithReconnectEventType", es.partialDispatch && es.reconnectEvent != ""},
+		{"WithReaderCallback", "WithCallback", es.readerCallback != nil && es.callback.Load() != nil},
+		{"WithReaderCallback", "WithConsumingCallback", es.readerCallback != nil && es.consumer != nil},
+		{"WithReaderCallback", "WithBatching", es.readerCallback != nil && es.batchCallback != nil},
+		{"WithReaderCallback", "WithDispatchQueue", es.readerCallback != nil && es.queueSize > 0},
+		{"WithReaderCallback", "WithPartialDispatch", es.readerCallback != nil && es.partialDispatch},
+		{"WithReaderCallback", "WithRawDataStream", es.readerCallback != nil && es.rawDataStream != nil},
+		{"WithReaderCallback", "WithUTF8Validation", es.readerCallback != nil && es.validateUTF8},
+		{"WithReaderCallback", "WithCharsetDecoder", es.readerCallback != nil && es.charsetDecoder != nil},
+		{"WithReaderCallback", "WithErrorEventType", es.readerCallback != nil && es.errorEvent != nil},
+		{"WithReaderCallback", "WithTruncateOversizedData", es.readerCallback != nil && es.truncateData},
+		{"WithRawDataStream", "WithConsumingCallback", es.rawDataStream != nil && es.consumer != nil},
+		{"WithRawDataStream", "WithPartialDispatch", es.rawDataStream != nil && es.partialDispatch},
+		{"WithDispatchQueue", "WithConsumingCallback", es.queueSize > 0 && es.consumer != nil},
+		{"WithDispatchQueue", "WithBatching", es.queueSize > 0 && es.batchCallback != nil},
+		{"WithBatching", "WithCallback", es.batchCallback != nil && es.callback.Load() != nil},
+		{"WithFramer", "WithReadHook", es.newFramer != nil && es.readHook != nil},
+		{"WithFramer", "WithMinReadChunk", es.newFramer != nil && es.minReadChunk != 0},
+		{"WithFramer", "WithReadBufferSoftLimit", es.newFramer != nil && es.readBufferSoftLimit != 0},
+		{"WithFramer", "WithMaxEmptyReads", es.newFramer != nil && es.maxEmptyReads != 0},
+		{"WithFramer", "WithRawComments", es.newFramer != nil && es.rawComments},
+		{"WithJSONFilter", "WithCallback", es.jsonCallback != nil && es.callback.Load() != nil},
+		{"WithJSONFilter", "WithConsumingCallback", es.jsonCallback != nil && es.consumer != nil},
+		{"WithJSONFilter", "WithBatching", es.jsonCallback != nil && es.batchCallback != nil},
+		{"WithJSONFilter", "WithReaderCallback", es.jsonCallback != nil && es.readerCallback != nil},
+		{"WithBatching", "WithConsumingCallback", es.batchCallback != nil && es.consumer != nil},
+		{"WithConsumingCallback", "WithTruncateOversizedData", es.consumer != nil && es.truncateData},
+		{"WithConsumingCallback", "WithErrorEventType", es.consumer != nil && es.errorEvent != nil},
+	}
+	for _, c := range conflicts {
+		if c.conflict {
+			return fmt.Errorf("%w: %s and %s", ErrConflictingOptions, c.a, c.b)
+		}
+	}
+	return nil
+}
+
+// Returns http.DefaultClient unless options require a custom one.
+func (es *EventSource) defaultClient() *http.Client {
+	if es.unixSocket == "" && es.minTLSVersion == 0 && es.cookieJar == nil && !es.disableKeepAlives {
+		return http.DefaultClient
+	}
+	client := &http.Client{Jar: es.cookieJar}
+	if es.unixSocket == "" && es.minTLSVersion == 0 && !es.disableKeepAlives {
+		return client
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DisableKeepAlives = es.disableKeepAlives
+	if es.unixSocket != "" {
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", es.unixSocket)
+		}
+	}
+	if es.minTLSVersion != 0 {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.MinVersion = es.minTLSVersion
+	}
+	client.Transport = tr
+	return client
+}
+
+// New creates an EventSource and starts receiving messages. Returns an error if the request cannot be created, if
+// conflicting options were used (see ErrConflictingOptions) or if the context set via WithContext is already done.
+func New(options ...Option) (*EventSource, error) {
+	es := &EventSource{
+		retryTimeout:  1 * time.Second,
+		done:          make(chan struct{}),
+		connected:     make(chan struct{}),
+		gotFirstEvent: make(chan struct{}),
+		stopErr:       ErrClosed,
+		contentLength: -1,
+	}
+	for _, opt := range options {
+		opt(es)
+	}
+	if err := es.validateOptions(); err != nil {
+		return nil, err
+	}
+	if es.jsonCallback != nil {
+		es.callback.Store(&es.jsonCallback)
+	}
+	if es.transport == nil {
+		if es.req == nil {
+			var err error
+			es.req, err = http.NewRequest("GET", es.url, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := es.parseFallbackURLs(); err != nil {
+			return nil, err
+		}
+		if es.client == nil {
+			es.client = es.defaultClient()
+		}
+		if es.stopStatuses == nil {
+			es.stopStatuses = []int{http.StatusNoContent}
+		}
+		es.transport = es.httpTransport
+	}
+	if es.ctx == nil {
+		es.ctx = context.Background()
+	} else if err := context.Cause(es.ctx); err != nil {
+		// otherwise EventSource would silently stop before even trying to connect
+		return nil, fmt.Errorf("eventsource: context is already done: %w", err)
+	}
+	if es.idStore != nil {
+		if err := es.loadLastID(); err != nil {
+			return nil, err
+		}
+	}
+	if es.retryPolicy == nil {
+		es.retryPolicy = DefaultRetryPolicy{}
+	}
+	es.bp = es.bp.withDefaults()
+	es.parentCtx = es.ctx
+	es.start()
+	return es, nil
+}
+
+// Starts the internal goroutine.
+func (es *EventSource) start() {
+	es.wg.Add(1)
+	es.ctx, es.cancel = context.WithCancel(es.parentCtx)
+	if es.queueSize > 0 {
+		es.queue = make(chan queueItem, es.queueSize)
+		es.queueDone = make(chan struct{})
+		es.queueFreed = make(chan struct{}, 1)
+		go es.runQueue()
+	}
+	go func() {
+		// done is closed first, it's closed by the time Close returns
+		defer es.wg.Done()
+		defer close(es.done)
+		for {
+			retry, err := es.processRequest()
+			if es.failFast && !es.wasConnected && err != nil {
+				es.stopErr = err
+				break
+			}
+			if !retry || !es.retrySleep(err) {
+				break
+			}
+		}
+		if es.idStore != nil {
+			es.saveLastID()
+			es.dispatchIDSaveError()
+		}
+		if es.batchCallback != nil {
+			es.closeBatch()
+		}
+		if es.queue != nil {
+			close(es.queue)
+			<-es.queueDone
+		}
+	}()
+}
+
+// Parses the stream of an already established response and calls cb for every message until the body ends. There is
+// no reconnection, status code and content type are not checked, it's up to the caller. Body is closed on return.
+// Returns nil if the stream simply ended, otherwise the read error (which is also delivered via callback).
+func ParseResponse(resp *http.Response, cb Callback, bp BufferParameters) error {
+	defer resp.Body.Close()
+	es := &EventSource{
+		bp:      bp.withDefaults(),
+		ctx:     context.Background(),
+		connCtx: context.Background(),
+	}
+	es.callback.Store(&cb)
+	_, err := es.processStream(resp.Body)
+	return err
+}
+
+// SetCallback atomically replaces the callback set via WithCallback, this way handlers can be changed without
+// recreating EventSource and losing the connection. A dispatch in progress completes with the old callback, all the
+// following ones use the new one. Nil removes the callback. Safe to call from any goroutine, including the callback
+// itself. Has no effect with WithConsumingCallback or WithBatching.
+func (es *EventSource) SetCallback(callback Callback) {
+	es.callback.Store(&callback)
+}
+
+// RetryTimeout returns the current reconnection delay. It's either the default one or the last one set by the server
+// via "retry" field. Safe to call from any goroutine.
+func (es *EventSource) RetryTimeout() time.Duration {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.retryTimeout
+}
+
+// BytesRead returns the total number of bytes read from all the streams, for bandwidth accounting. Bytes are counted
+// as they come from the transport, before any parsing. When the request sets "Accept-Encoding" manually, the body is
+// decompressed by EventSource and compressed bytes are counted. Otherwise Go's http.Transport decompresses gzip
+// transparently, in that case decompressed bytes are counted, compressed ones are not observable. Per-read counts are
+// available via WithReadHook. Safe to call from any goroutine.
+func (es *EventSource) BytesRead() uint64 {
+	return es.bytesRead.Load()
+}
+
+// ConnBytesRead returns the number of bytes read from the current connection (or the last one, if there is none), it's
+// reset on each connection attempt. Counted the same way as BytesRead. Safe to call from any goroutine.
+func (es *EventSource) ConnBytesRead() uint64 {
+	return es.connBytesRead.Load()
+}
+
+// Counts bytes read from the stream, see BytesRead.
+func (es *EventSource) addBytesRead(n int) {
+	es.bytesRead.Add(uint64(n))
+	es.connBytesRead.Add(uint64(n))
+}
+
+// BufferStats returns the peak sizes the buffers reached since EventSource was created. For id, event and data
+// buffers it's the largest field value seen (data of a message counts as a whole), for the read buffer it's the
+// size it has grown to. Safe to call from any goroutine.
+func (es *EventSource) BufferStats() BufferStats {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.stats
+}
+
+// AllocatedBytes returns the total capacity of the id, event, data and read buffers at the moment. Buffers are released
+// on reconnect. Summed across instances it gives a view of memory held by EventSources. Safe to call from any
+// goroutine.
+func (es *EventSource) AllocatedBytes() int {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.allocated
+}
+
+// RemoteAddr returns the remote address of the connection the last accepted HTTP response came from. Useful to see
+// which server instance behind a load balancer is used. Returns an empty string if there was no such response yet or
+// if the address isn't available (e.g. custom http.RoundTripper or custom transport, see WithTransport). Safe to
+// call from any goroutine.
+func (es *EventSource) RemoteAddr() string {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.remoteAddr
+}
+
+// TimeToFirstEvent returns the time between the current connection was established and the first message arrived
+// on it, a latency SLI handy for comparing endpoints. It's reset on reconnect, zero is returned if no message has
+// arrived yet on the current connection. Safe to call from any goroutine.
+func (es *EventSource) TimeToFirstEvent() time.Duration {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.firstEventDelay
+}
+
+// ResponseHeaders returns a copy of the headers of the last accepted HTTP response, e.g. for parsing Server-Timing per
+// connection. Returns nil if there was no such response yet or if custom transport is used (see WithTransport). Safe
+// to call from any goroutine.
+func (es *EventSource) ResponseHeaders() http.Header {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.responseHeader.Clone()
+}
+
+// ContentLength returns the Content-Length of the last accepted HTTP response, -1 if it's unknown. An event stream is
+// endless and shouldn't have one, but misconfigured servers (or proxies) may send it, then the body ends after exactly
+// that many bytes and EventSource keeps reconnecting. Useful to diagnose such cases. Safe to call from any goroutine.
+func (es *EventSource) ContentLength() int64 {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.contentLength
+}
+
+// TLSState returns a copy of the TLS connection state of the last accepted HTTP response, e.g. to check the TLS
+// version, the cipher suite or the peer certificates. Returns nil for plaintext connections, if there was no such
+// response yet or if custom transport is used (see WithTransport). Safe to call from any goroutine.
+func (es *EventSource) TLSState() *tls.ConnectionState {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.tlsState == nil {
+		return nil
+	}
+	state := *es.tlsState
+	return &state
+}
+
+// Close forcefully and gracefully stops EventSource from receiving messages. It waits until internal goroutine returns.
+// Once Close() returns it's guaranteed that no callback calls will be made. After calling Close() the EventSource
+// can only be resumed via Restart, otherwise it's left for garbage collection.
+func (es *EventSource) Close() {
+	es.cancel()
+	es.wg.Wait()
+}
+
+// WaitConnected blocks until the first connection is successfully established (HTTP response has 200 status and
+// correct content type). Returns ctx error if ctx is done first, or the reason of stopping (ErrClosed,
+// ErrStreamEnded) if EventSource stops without ever connecting.
+func (es *EventSource) WaitConnected(ctx context.Context) error {
+	select {
+	case <-es.connected:
+		return nil
+	case <-es.done:
+		select {
+		case <-es.connected:
+			return nil
+		default:
+			return es.stopErr
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitForEvent blocks until the first message is dispatched and returns its copy. It's stronger than WaitConnected,
+// handy for readiness probes: the server not only accepted the connection, but actually streams data. Returns ctx
+// error if ctx is done first, or the reason of stopping if EventSource stops without receiving any message.
+func (es *EventSource) WaitForEvent(ctx context.Context) (Message, error) {
+	select {
+	case <-es.gotFirstEvent:
+		return es.firstEvent.Clone(), nil
+	case <-es.done:
+		select {
+		case <-es.gotFirstEvent:
+			return es.firstEvent.Clone(), nil
+		default:
+			return Message{}, es.stopErr
+		}
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// All returns an iterator over messages, an alternative to callbacks: for msg, err := range es.All(ctx). Every message
+// is a copy (see Message.Clone), the loop body may retain it. Errors are yielded as the second value with an empty
+// message, the iteration goes on after them unless they are terminal (e.g. ErrStreamEnded or ErrGaveUp): it ends once
+// EventSource stops, or once ctx is done, or once the loop body breaks out. During the iteration the callback set via
+// WithCallback (or SetCallback) is replaced, it's restored afterwards, messages dispatched before the iteration starts
+// go to it. The read loop waits for the loop body, like it waits for a callback. Close may be called from the loop
+// body, the iteration ends then. Has no effect with WithConsumingCallback or WithBatching.
+func (es *EventSource) All(ctx context.Context) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		items := make(chan queueItem)
+		stop := make(chan struct{})
+		var cb Callback = func(msg Message, err error) {
+			select {
+			case items <- queueItem{msg: msg.Clone(), err: err}:
+			case <-stop:
+			case <-es.ctx.Done():
+				// closed from the loop body, which doesn't take the item anymore
+			}
+		}
+		done := es.Done()
+		prev := es.callback.Swap(&cb)
+		defer func() {
+			close(stop)
+			es.callback.Store(prev)
+		}()
+		for {
+			select {
+			case item := <-items:
+				if !yield(item.msg, item.err) {
+					return
+				}
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// NewWithFirstConnect is like New, but it also waits until the first connection is established (see WaitConnected).
+// When used together with WithFailFast, the error of the first connection attempt is returned. If ctx is done first,
+// its error is returned. EventSource is closed on error.
+func NewWithFirstConnect(ctx context.Context, options ...Option) (*EventSource, error) {
+	es, err := New(options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := es.WaitConnected(ctx); err != nil {
+		es.Close()
+		return nil, err
+	}
+	return es, nil
+}
+
+// Done returns a channel which is closed when the internal goroutine exits, either because of Close or because
+// EventSource stopped on its own (e.g. ErrStreamEnded or ErrGaveUp). No callback calls are made after that.
+func (es *EventSource) Done() <-chan struct{} {
+	return es.done
+}
+
+// Restart resumes receiving messages after the EventSource has stopped, e.g. after Close returned. The configuration
+// is the same, the last event ID is kept. Returns ErrNotStopped if the internal goroutine is still running, or an
+// error if the context set via WithContext is done. Must not be called concurrently with other methods.
+func (es *EventSource) Restart() error {
+	select {
+	case <-es.done:
+	default:
+		return ErrNotStopped
+	}
+	if err := context.Cause(es.parentCtx); err != nil {
+		return fmt.Errorf("eventsource: context is already done: %w", err)
+	}
+	es.done = make(chan struct{})
+	es.connected = make(chan struct{})
+	es.wasConnected = false
+	es.stopErr = ErrClosed
+	es.attempt = 0
+	es.failingSince = time.Time{}
+	es.batchClosed = false
+	es.start()
+	return nil
+}
+
+// CloseContext is like Close, but it waits for the internal goroutine to return only until ctx is done. In that case
+// the ctx error is returned and the goroutine exits some time later (e.g. once the callback returns).
+func (es *EventSource) CloseContext(ctx context.Context) error {
+	es.cancel()
+	select {
+	case <-es.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,38 @@
+package eventsource_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/nsf/eventsource"
+	"io"
+	"strings"
+)
+
+// Any reader can be used as a source of events. Here the stream comes from a string, but it could as well be a
+// WebSocket connection (e.g. via websocket.NetConn) or a pipe.
+func ExampleWithTransport() {
+	done := make(chan struct{})
+	transport := func(ctx context.Context, lastEventID []byte) (io.ReadCloser, error) {
+		select {
+		case <-done:
+			// the stream was already consumed, wait until EventSource is closed
+			<-ctx.Done()
+			return nil, ctx.Err()
+		default:
+		}
+		return io.NopCloser(strings.NewReader("event: greeting\ndata: hello\n\n")), nil
+	}
+	es, err := eventsource.New(
+		eventsource.WithTransport(transport),
+		eventsource.WithCallback(func(msg eventsource.Message, err error) {
+			fmt.Printf("%s: %s\n", msg.Event, msg.Data)
+			close(done)
+		}),
+	)
+	if err != nil {
+		panic(err)
+	}
+	<-done
+	es.Close()
+	// Output: greeting: hello
+}
@@ -0,0 +1,56 @@
+package eventsource
+
+import (
+	"fmt"
+	"net/url"
+)
+
+const defaultFallbackAfter = 3
+
+// Sets the backup endpoints, a client-side failover without an external load balancer. Once the connection attempts
+// to the current URL fail a number of times in a row (see WithFallbackAfter), the next URL is used: the primary one
+// (see WithURL and WithRequest) is followed by urls, round-robin. Only failed connection attempts count (e.g. network
+// errors or non-200 statuses), the counter is reset once a connection is established. The last event ID is carried
+// over as usual. URLs are parsed by New, the prototype request is used for the rest. Can't be used together with
+// WithTransport.
+func WithFallbackURLs(urls ...string) Option {
+	return func(es *EventSource) {
+		es.fallbackURLs = append(es.fallbackURLs, urls...)
+	}
+}
+
+// Sets the number of failed connection attempts in a row after which the next URL is used, see WithFallbackURLs.
+// 3 by default.
+func WithFallbackAfter(failures int) Option {
+	return func(es *EventSource) {
+		es.fallbackAfter = failures
+	}
+}
+
+// Parses the fallback URLs, the primary one goes first.
+func (es *EventSource) parseFallbackURLs() error {
+	es.urls = []*url.URL{es.req.URL}
+	for _, s := range es.fallbackURLs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return fmt.Errorf("eventsource: invalid fallback URL: %w", err)
+		}
+		es.urls = append(es.urls, u)
+	}
+	if es.fallbackAfter <= 0 {
+		es.fallbackAfter = defaultFallbackAfter
+	}
+	return nil
+}
+
+// Counts a failed connection attempt, switches to the next URL if there are too many of them.
+func (es *EventSource) connectFailed() {
+	if len(es.urls) < 2 {
+		return
+	}
+	es.urlFailures++
+	if es.urlFailures >= es.fallbackAfter {
+		es.urlFailures = 0
+		es.urlIndex = (es.urlIndex + 1) % len(es.urls)
+	}
+}
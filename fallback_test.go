@@ -0,0 +1,53 @@
+package eventsource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackURLs(t *testing.T) {
+	assert := assert.New(t)
+	var primaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if primaryHits.Add(1) == 1 {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("id: 7\ndata: primary\n\n"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	lastEventIDs := make(chan string, 10)
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs <- r.Header.Get("Last-Event-Id")
+		sseHandler("data: fallback\n\n")(w, r)
+	}))
+	defer fallback.Close()
+
+	cb, msgs := collect()
+	es, err := New(
+		WithURL(primary.URL),
+		WithFallbackURLs(fallback.URL),
+		WithFallbackAfter(2),
+		WithDefaultRetryTimeout(time.Millisecond),
+		WithCallback(cb),
+	)
+	assert.NoError(err)
+	defer es.Close()
+	assert.Equal(result{id: "7", data: "primary"}, receive(t, msgs))
+	// the successful connection doesn't count, two failures in a row do
+	assert.ErrorIs(receive(t, msgs).err, ErrInvalidStatus)
+	assert.ErrorIs(receive(t, msgs).err, ErrInvalidStatus)
+	assert.Equal(result{data: "fallback"}, receive(t, msgs))
+	assert.Equal(int32(3), primaryHits.Load())
+	// resumed with the last event ID
+	assert.Equal("7", <-lastEventIDs)
+
+	_, err = New(WithURL(primary.URL), WithFallbackURLs("http://[::1"))
+	assert.Error(err)
+}
@@ -0,0 +1,42 @@
+package eventsource
+
+import "bytes"
+
+// Dispatches only messages of the given event types. Messages without "event" field have empty type, include ""
+// to receive them. Combined with WithEventPrefixFilter using OR semantics: a message is dispatched if it matches any
+// of the filters. Filtered out messages still update the last event ID.
+func WithEventFilter(types ...string) Option {
+	return func(es *EventSource) {
+		for _, t := range types {
+			es.eventFilter = append(es.eventFilter, []byte(t))
+		}
+	}
+}
+
+// Dispatches only messages whose event type starts with one of the prefixes, e.g. "user." matches "user.created" and
+// "user.updated". See WithEventFilter for how filters are combined.
+func WithEventPrefixFilter(prefixes ...string) Option {
+	return func(es *EventSource) {
+		for _, p := range prefixes {
+			es.eventPrefixFilter = append(es.eventPrefixFilter, []byte(p))
+		}
+	}
+}
+
+// Reports whether the current message passes the event filters.
+func (es *EventSource) eventAllowed() bool {
+	if es.eventFilter == nil && es.eventPrefixFilter == nil {
+		return true
+	}
+	for _, t := range es.eventFilter {
+		if bytes.Equal(es.eventBuf, t) {
+			return true
+		}
+	}
+	for _, p := range es.eventPrefixFilter {
+		if bytes.HasPrefix(es.eventBuf, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package eventsource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventFilter(t *testing.T) {
+	assert := assert.New(t)
+	stream := "data: a\n\nevent: user.created\ndata: b\n\nevent: user\ndata: c\n\nevent: order.created\ndata: d\n\n" +
+		"event: user.updated\ndata: e\n\nevent: ping\ndata: f\n\n"
+	check := func(options []Option, expected ...string) {
+		cb, msgs := collect()
+		tr, _ := streamTransport(stream + "event: end\ndata: end\n\n")
+		es, err := New(append(options, WithTransport(tr), WithCallback(cb), WithEventFilter("end"))...)
+		assert.NoError(err)
+		var data []string
+		for r := receive(t, msgs); r.data != "end"; r = receive(t, msgs) {
+			data = append(data, r.data)
+		}
+		assert.Equal(expected, data)
+		es.Close()
+	}
+	check([]Option{WithEventPrefixFilter("user.")}, "b", "e")
+	check([]Option{WithEventPrefixFilter("user.", "order.")}, "b", "d", "e")
+	check([]Option{WithEventPrefixFilter("user"), WithEventFilter("ping")}, "b", "c", "e", "f")
+	check([]Option{WithEventFilter("")}, "a")
+	check([]Option{WithEventPrefixFilter("")}, "a", "b", "c", "d", "e", "f")
+	check([]Option{WithEventPrefixFilter("admin.")})
+}
@@ -0,0 +1,62 @@
+package eventsource
+
+import "io"
+
+// A single field of a message, as returned by Framer. Empty name means comment.
+type Field struct {
+	Name  []byte
+	Value []byte
+}
+
+// Splits the stream into messages. It's a way to use an alternative wire format (e.g. length-prefixed binary one)
+// with reconnection, last event ID and callback machinery of EventSource. See: WithFramer.
+type Framer interface {
+	// Returns the fields of the next message, in order. Slices may point to internal buffers, they only have to stay
+	// valid until the next call. Errors are handled like read errors of the text stream, io.EOF means that the stream
+	// simply ended.
+	ReadFrame() ([]Field, error)
+}
+
+// Replaces the text framing of the event stream, newFramer is called for every connection with its stream (after
+// decompression and recording, if any). Fields are handled exactly like the text ones: known fields make the message,
+// unknown ones are ignored, fields with empty name are comments. The message is submitted after the last field of the
+// frame. BufferParameters limits apply, except the read buffer one. Can't be used together with options which tune the
+// reading of the text stream: WithReadHook, WithMinReadChunk, WithReadBufferSoftLimit, WithMaxEmptyReads and
+// WithRawComments.
+func WithFramer(newFramer func(r io.Reader) Framer) Option {
+	return func(es *EventSource) {
+		es.newFramer = newFramer
+	}
+}
+
+// byteCounter counts bytes read from the stream, see EventSource.BytesRead.
+type byteCounter struct {
+	r  io.Reader
+	es *EventSource
+}
+
+func (c byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.es.addBytesRead(n)
+	return n, err
+}
+
+func (es *EventSource) processFrames(f Framer) (bool, error) {
+	for {
+		fields, err := f.ReadFrame()
+		if err != nil {
+			return es.readError(err)
+		}
+		for _, field := range fields {
+			if es.msgErr != nil {
+				// the message is dropped, skip the remaining fields
+				break
+			}
+			es.processField(field.Name, field.Value)
+		}
+		es.submit()
+		if es.reconnectRequested {
+			return es.reconnectNow()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package eventsource
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// binaryFramer reads frames of the form: number of fields, then name length, name, value length, value for every
+// field. All numbers are single bytes.
+type binaryFramer struct {
+	r *bufio.Reader
+}
+
+func (f binaryFramer) readBytes() ([]byte, error) {
+	n, err := f.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(f.r, b)
+	return b, err
+}
+
+func (f binaryFramer) ReadFrame() ([]Field, error) {
+	n, err := f.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]Field, n)
+	for i := range fields {
+		if fields[i].Name, err = f.readBytes(); err != nil {
+			return nil, err
+		}
+		if fields[i].Value, err = f.readBytes(); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// frame encodes the fields given as name, value pairs.
+func frame(fields ...string) string {
+	var sb strings.Builder
+	sb.WriteByte(byte(len(fields) / 2))
+	for _, f := range fields {
+		sb.WriteByte(byte(len(f)))
+		sb.WriteString(f)
+	}
+	return sb.String()
+}
+
+func TestFramer(t *testing.T) {
+	assert := assert.New(t)
+	cb, msgs := collect()
+	comments := make(chan string, 10)
+	tr, ids := streamTransport(
+		frame("retry", "1", "id", "1", "data", "a", "data", "b")+frame("", "comment")+frame("event", "foo", "data", "c")+"\x00",
+		frame("data", "too long")+frame("data", "d"),
+	)
+	es, err := New(
+		WithTransport(tr),
+		WithCallback(cb),
+		WithCommentCallback(func(comment []byte) { comments <- string(comment) }),
+		WithBufferParameters(BufferParameters{MaxData: 4}),
+		WithFramer(func(r io.Reader) Framer { return binaryFramer{bufio.NewReader(r)} }),
+	)
+	assert.NoError(err)
+	defer es.Close()
+	assert.Equal(result{id: "1", data: "a\nb"}, receive(t, msgs))
+	assert.Equal("comment", <-comments)
+	assert.Equal(result{event: "foo", data: "c"}, receive(t, msgs))
+	// reconnected with the last event ID
+	assert.Equal("", <-ids)
+	assert.Equal("1", <-ids)
+	assert.ErrorIs(receive(t, msgs).err, ErrBufferFull)
+	assert.Equal(result{data: "d"}, receive(t, msgs))
+	assert.NotZero(es.BytesRead())
+
+	// options of the text stream reading don't apply
+	newFramer := WithFramer(func(r io.Reader) Framer { return binaryFramer{bufio.NewReader(r)} })
+	for _, opt := range []Option{
+		WithReadHook(func(n, buffered, size int) {}),
+		WithMinReadChunk(1024),
+		WithReadBufferSoftLimit(1024),
+		WithMaxEmptyReads(10),
+		WithRawComments(),
+	} {
+		_, err = New(WithTransport(tr), WithCallback(cb), newFramer, opt)
+		assert.ErrorIs(err, ErrConflictingOptions)
+	}
+}
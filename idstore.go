@@ -0,0 +1,114 @@
+package eventsource
+
+import (
+	"fmt"
+	"time"
+)
+
+// Persistent storage of the last event ID (a file, Redis, etc.), makes it possible to resume the stream after process
+// restart. See: WithIDStore.
+type IDStore interface {
+	// Returns the last event ID saved, empty string if there is none.
+	Load() (string, error)
+
+	// Saves the last event ID.
+	Save(id string) error
+}
+
+// Sets the store of the last event ID. The ID is loaded by New (its error is returned by New) and it's used as
+// "Last-Event-Id" header of the first request. The ID is saved every time a message with "id" field is received (see
+// WithIDSaveInterval for throttling). Save errors are delivered via callback, they don't affect the stream.
+func WithIDStore(store IDStore) Option {
+	return func(es *EventSource) {
+		es.idStore = store
+	}
+}
+
+// Limits the frequency of saves to the store set via WithIDStore, the latest ID is saved at most once per interval.
+// An ID received within the interval after the previous save stays pending until the interval ends, then it's saved
+// from a timer, even if the stream went quiet. The pending ID is always saved when EventSource stops (e.g. on Close).
+// Errors of saves made from the timer are delivered via callback later, with the next ID or when EventSource stops.
+func WithIDSaveInterval(d time.Duration) Option {
+	return func(es *EventSource) {
+		es.idSaveInterval = d
+	}
+}
+
+// Updates the last event ID, it survives reconnects, hence it has its own buffer.
+func (es *EventSource) setLastID(id []byte) {
+	es.lastID = append(es.lastID[:0], id...)
+	if es.idStore == nil {
+		return
+	}
+	es.idMu.Lock()
+	es.idPending = true
+	es.pendingID = string(id)
+	wait := es.idSaveInterval - time.Since(es.idSavedAt)
+	if es.idSaveInterval != 0 && wait > 0 && es.idSaveTimer == nil {
+		es.idSaveTimer = time.AfterFunc(wait, es.flushLastID)
+	}
+	es.idMu.Unlock()
+	if es.idSaveInterval == 0 || wait <= 0 {
+		es.saveLastID()
+	}
+	es.dispatchIDSaveError()
+}
+
+// Saves the pending last event ID once the save interval ends, called from the timer goroutine.
+func (es *EventSource) flushLastID() {
+	es.idMu.Lock()
+	defer es.idMu.Unlock()
+	es.idSaveTimer = nil
+	if err := es.saveLastIDLocked(); err != nil {
+		// the callback can't be called from here, it's delivered by the internal goroutine later
+		es.idSaveErr = err
+	}
+}
+
+// Saves the pending last event ID, if any, errors are delivered via callback.
+func (es *EventSource) saveLastID() {
+	es.idMu.Lock()
+	if es.idSaveTimer != nil {
+		es.idSaveTimer.Stop()
+		es.idSaveTimer = nil
+	}
+	err := es.saveLastIDLocked()
+	es.idMu.Unlock()
+	if err != nil {
+		es.dispatch(Message{}, err)
+	}
+}
+
+// Saves are serialized by idMu, this way the timer and the internal goroutine never save out of order.
+func (es *EventSource) saveLastIDLocked() error {
+	if !es.idPending {
+		return nil
+	}
+	es.idPending = false
+	es.idSavedAt = time.Now()
+	if err := es.idStore.Save(es.pendingID); err != nil {
+		return fmt.Errorf("eventsource: id store save error: %w", err)
+	}
+	return nil
+}
+
+// Delivers the error of the last save made from the timer, if any.
+func (es *EventSource) dispatchIDSaveError() {
+	es.idMu.Lock()
+	err := es.idSaveErr
+	es.idSaveErr = nil
+	es.idMu.Unlock()
+	if err != nil {
+		es.dispatch(Message{}, err)
+	}
+}
+
+// Seeds the last event ID from the store.
+func (es *EventSource) loadLastID() error {
+	id, err := es.idStore.Load()
+	if err != nil {
+		return fmt.Errorf("eventsource: id store load error: %w", err)
+	}
+	es.lastID = []byte(id)
+	return nil
+}
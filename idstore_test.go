@@ -0,0 +1,122 @@
+package eventsource
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memStore is an in-memory IDStore which remembers all saves.
+type memStore struct {
+	mu      sync.Mutex
+	id      string
+	saves   []string
+	loadErr error
+	saveErr error
+}
+
+func (s *memStore) Load() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id, s.loadErr
+}
+
+func (s *memStore) Save(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.id = id
+	s.saves = append(s.saves, id)
+	return nil
+}
+
+func (s *memStore) Saves() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+func TestIDStore(t *testing.T) {
+	assert := assert.New(t)
+	store := &memStore{id: "41"}
+	cb, msgs := collect()
+	tr, ids := streamTransport("id: 42\ndata: a\n\ndata: b\n\nid: 43\n\n")
+	es, err := New(WithTransport(tr), WithCallback(cb), WithIDStore(store))
+	assert.NoError(err)
+	defer es.Close()
+	// the stored id is used for the first request
+	assert.Equal("41", <-ids)
+	assert.Equal(result{id: "42", data: "a"}, receive(t, msgs))
+	assert.Equal(result{data: "b"}, receive(t, msgs))
+	assert.Eventually(func() bool { return len(store.Saves()) == 2 }, 5*time.Second, time.Millisecond)
+	assert.Equal([]string{"42", "43"}, store.Saves())
+}
+
+func TestIDStoreErrors(t *testing.T) {
+	assert := assert.New(t)
+	errTest := errors.New("test")
+	tr, _ := streamTransport("")
+	_, err := New(WithTransport(tr), WithIDStore(&memStore{loadErr: errTest}))
+	assert.ErrorIs(err, errTest)
+
+	cb, msgs := collect()
+	tr, _ = streamTransport("id: 1\ndata: a\n\n")
+	es, err := New(WithTransport(tr), WithCallback(cb), WithIDStore(&memStore{saveErr: errTest}))
+	assert.NoError(err)
+	defer es.Close()
+	assert.ErrorIs(receive(t, msgs).err, errTest)
+	assert.Equal(result{id: "1", data: "a"}, receive(t, msgs))
+}
+
+func TestIDSaveInterval(t *testing.T) {
+	assert := assert.New(t)
+	store := &memStore{}
+	cb, msgs := collect()
+	tr, _ := streamTransport("id: 1\ndata: a\n\nid: 2\ndata: b\n\nid: 3\ndata: c\n\n")
+	es, err := New(WithTransport(tr), WithCallback(cb), WithIDStore(store), WithIDSaveInterval(time.Hour))
+	assert.NoError(err)
+	for range 3 {
+		receive(t, msgs)
+	}
+	// throttled, only the first one is saved
+	assert.Equal([]string{"1"}, store.Saves())
+	// the final one is saved on close
+	es.Close()
+	assert.Equal([]string{"1", "3"}, store.Saves())
+}
+
+func TestIDSaveIntervalIdle(t *testing.T) {
+	assert := assert.New(t)
+	store := &memStore{}
+	cb, msgs := collect()
+	tr, _ := streamTransport("id: 1\ndata: a\n\nid: 2\ndata: b\n\n")
+	es, err := New(WithTransport(tr), WithCallback(cb), WithIDStore(store), WithIDSaveInterval(50*time.Millisecond))
+	assert.NoError(err)
+	defer es.Close()
+	for range 2 {
+		receive(t, msgs)
+	}
+	// the stream goes quiet, the pending one is saved once the interval ends
+	assert.Eventually(func() bool {
+		return len(store.Saves()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal([]string{"1", "2"}, store.Saves())
+}
+
+func TestSuppressFirstLastEventID(t *testing.T) {
+	assert := assert.New(t)
+	cb, msgs := collect()
+	tr, ids := streamTransport("retry: 1\ndata: a\n\n\x00", "")
+	es, err := New(WithTransport(tr), WithCallback(cb), WithIDStore(&memStore{id: "41"}), WithSuppressFirstLastEventID())
+	assert.NoError(err)
+	defer es.Close()
+	assert.Equal("", <-ids)
+	assert.Equal(result{data: "a"}, receive(t, msgs))
+	// the seeded id is sent on reconnect
+	assert.Equal("41", <-ids)
+}
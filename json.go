@@ -0,0 +1,60 @@
+package eventsource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// This error is delivered via the WithJSONFilter callback when the message data is not valid JSON (and such messages
+// aren't skipped). Use errors.Is to check for this error.
+var ErrInvalidJSON = errors.New("eventsource: data is not valid JSON")
+
+// Messages with data decoded as JSON are delivered via this callback, see: WithJSONFilter. For a decoded message v
+// points to the value and err is nil. Otherwise v is nil and msg is the raw message: err matches ErrInvalidJSON if the
+// data is not valid JSON at all, or it wraps the json error if the data doesn't fit T. Messages with empty data (e.g.
+// "data:" with no value, or id-only messages, see WithDispatchIDOnly) have nothing to decode, they are delivered with
+// nil v and nil err. Stream errors are delivered as usual, with nil v and empty msg. The msg slices are only valid
+// until the callback returns, v stays valid.
+type JSONCallback[T any] func(msg Message, v *T, err error)
+
+// What to do with messages whose data is not valid JSON. See: WithJSONFilter.
+type JSONInvalidPolicy int
+
+const (
+	// Deliver the raw message with ErrInvalidJSON. The default.
+	JSONInvalidError JSONInvalidPolicy = iota
+
+	// Skip the message silently, e.g. for streams which mix JSON data with plain text events.
+	JSONInvalidSkip
+)
+
+// Sets the callback which receives message data decoded as JSON into a new T, see JSONCallback. Messages whose data
+// is not valid JSON are handled according to policy, data which is valid JSON but can't be decoded into T (e.g. wrong
+// field types) is always delivered as an error. Can't be used together with other callbacks (WithCallback,
+// WithConsumingCallback, WithBatching or WithReaderCallback), SetCallback replaces it.
+func WithJSONFilter[T any](callback JSONCallback[T], policy JSONInvalidPolicy) Option {
+	return func(es *EventSource) {
+		es.jsonCallback = func(msg Message, err error) {
+			if err != nil || len(msg.Data) == 0 {
+				callback(msg, nil, err)
+				return
+			}
+			v := new(T)
+			// the data is validated before anything is decoded, a syntax error means it's not JSON at all
+			err = json.Unmarshal(msg.Data, v)
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				if policy != JSONInvalidSkip {
+					callback(msg, nil, fmt.Errorf("%w: %w", ErrInvalidJSON, err))
+				}
+				return
+			}
+			if err != nil {
+				callback(msg, nil, fmt.Errorf("eventsource: json decode error: %w", err))
+				return
+			}
+			callback(msg, v, nil)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package eventsource
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONFilter(t *testing.T) {
+	assert := assert.New(t)
+	type point struct {
+		X, Y int
+	}
+	type decoded struct {
+		event string
+		v     *point
+		err   error
+	}
+	stream := "data: {\"x\": 1, \"y\": 2}\n\n" +
+		"event: ping\ndata: hello\n\n" +
+		"data: {\"x\": \"one\"}\n\n" +
+		"data:\n\n" +
+		"data: {\ndata: \"x\": 3\ndata: }\n\n" +
+		"data: " + strings.Repeat("1", 100) + "\n\n"
+	for _, policy := range []JSONInvalidPolicy{JSONInvalidError, JSONInvalidSkip} {
+		results := make(chan decoded, 10)
+		tr, _ := streamTransport(stream)
+		es, err := New(WithTransport(tr), WithBufferParameters(BufferParameters{MaxData: 64}), WithJSONFilter(func(msg Message, v *point, err error) {
+			results <- decoded{string(msg.Event), v, err}
+		}, policy))
+		assert.NoError(err)
+		r := <-results
+		assert.Equal(&point{1, 2}, r.v)
+		assert.NoError(r.err)
+		if policy == JSONInvalidError {
+			// the raw message is delivered
+			r = <-results
+			assert.Equal("ping", r.event)
+			assert.Nil(r.v)
+			assert.ErrorIs(r.err, ErrInvalidJSON)
+		}
+		// valid JSON which doesn't fit the type is never skipped
+		r = <-results
+		assert.Nil(r.v)
+		var typeErr *json.UnmarshalTypeError
+		assert.ErrorAs(r.err, &typeErr)
+		// empty data has nothing to decode
+		r = <-results
+		assert.Nil(r.v)
+		assert.NoError(r.err)
+		r = <-results
+		assert.Equal(&point{X: 3}, r.v)
+		// stream errors are delivered as usual
+		r = <-results
+		assert.Nil(r.v)
+		assert.ErrorIs(r.err, ErrBufferFull)
+		es.Close()
+	}
+
+	cb := func(Message, *point, error) {}
+	for _, opt := range []Option{
+		WithCallback(func(Message, error) {}),
+		WithConsumingCallback(func(Message, bool, error) int { return 0 }),
+		WithBatching(10, 0, func([]Message, error) {}),
+		WithReaderCallback(func(Message, io.Reader, error) {}),
+	} {
+		_, err := New(WithURL("http://localhost"), WithJSONFilter(cb, JSONInvalidError), opt)
+		assert.ErrorIs(err, ErrConflictingOptions)
+	}
+	// the Manager sets its own callback
+	m := NewManager(func(string, Message, error) {})
+	assert.ErrorIs(m.Add("json", WithURL("http://localhost"), WithJSONFilter(cb, JSONInvalidError)), ErrConflictingOptions)
+}
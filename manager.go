@@ -0,0 +1,165 @@
+package eventsource
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// This error is returned by Manager.Add when a source with the same name is already added.
+var ErrSourceExists = errors.New("eventsource: source already exists")
+
+// Messages of all sources of a Manager are delivered via this callback, tagged with the name of the source (the one
+// passed to Manager.Add). Otherwise it's the same as Callback: msg slices are only valid until the callback returns.
+type ManagerCallback func(source string, msg Message, err error)
+
+// Health of a single Manager source, see Manager.Health.
+type SourceHealth struct {
+	// Number of messages and errors delivered from the source.
+	Messages uint64
+	Errors   uint64
+
+	// When the last message and the last error were delivered, zero if there were none.
+	LastMessageAt time.Time
+	LastErrorAt   time.Time
+
+	// The last error delivered, nil if there was none.
+	LastError error
+
+	// Total number of bytes read from the source, see EventSource.BytesRead.
+	BytesRead uint64
+
+	// True when the source stopped on its own (e.g. ErrStreamEnded or ErrGaveUp), it stays in the Manager until it's
+	// removed.
+	Stopped bool
+}
+
+// Manager owns multiple EventSources (sources) and multiplexes their messages into a single callback, every message is
+// tagged with the name of its source. Sources can be added and removed at any time. The callback is never called
+// concurrently, thus a slow callback stalls all sources. Manager methods must not be called from the callback: they
+// wait for the sources to stop, which never happens while the callback is running.
+type Manager struct {
+	callback ManagerCallback
+
+	// serializes callback calls of all sources
+	cbMu sync.Mutex
+
+	mu      sync.Mutex
+	sources map[string]*managedSource
+}
+
+type managedSource struct {
+	es     *EventSource
+	health SourceHealth
+}
+
+// Creates an empty Manager, messages of all sources are delivered via callback.
+func NewManager(callback ManagerCallback) *Manager {
+	return &Manager{
+		callback: callback,
+		sources:  make(map[string]*managedSource),
+	}
+}
+
+// Adds a source named name, options are passed to New as is, except for the callback: the Manager sets its own one,
+// thus WithCallback is overridden and callbacks which conflict with it (e.g. WithConsumingCallback) are rejected.
+// Returns ErrSourceExists if the name is taken, or the error of New.
+func (m *Manager) Add(name string, options ...Option) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sources[name]; ok {
+		return fmt.Errorf("%w: %s", ErrSourceExists, name)
+	}
+	ms := &managedSource{}
+	options = append(slices.Clip(options), WithCallback(func(msg Message, err error) {
+		m.deliver(name, ms, msg, err)
+	}))
+	es, err := New(options...)
+	if err != nil {
+		return err
+	}
+	ms.es = es
+	m.sources[name] = ms
+	return nil
+}
+
+func (m *Manager) deliver(name string, ms *managedSource, msg Message, err error) {
+	m.mu.Lock()
+	if err != nil {
+		ms.health.Errors++
+		ms.health.LastErrorAt = time.Now()
+		ms.health.LastError = err
+	} else {
+		ms.health.Messages++
+		ms.health.LastMessageAt = time.Now()
+	}
+	m.mu.Unlock()
+
+	m.cbMu.Lock()
+	defer m.cbMu.Unlock()
+	m.callback(name, msg, err)
+}
+
+// Closes the source named name and removes it. Once Remove returns, no callback calls are made for the source.
+// Returns false if there is no such source.
+func (m *Manager) Remove(name string) bool {
+	m.mu.Lock()
+	ms, ok := m.sources[name]
+	delete(m.sources, name)
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	ms.es.Close()
+	return true
+}
+
+// Returns the sorted names of all sources.
+func (m *Manager) Sources() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.sources))
+	for name := range m.sources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Returns the health of the source named name, false if there is no such source.
+func (m *Manager) Health(name string) (SourceHealth, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms, ok := m.sources[name]
+	if !ok {
+		return SourceHealth{}, false
+	}
+	health := ms.health
+	health.BytesRead = ms.es.BytesRead()
+	select {
+	case <-ms.es.Done():
+		health.Stopped = true
+	default:
+	}
+	return health, true
+}
+
+// Closes all sources and removes them. Once CloseAll returns, no callback calls are made. The Manager can still be
+// used to add new sources.
+func (m *Manager) CloseAll() {
+	m.mu.Lock()
+	sources := m.sources
+	m.sources = make(map[string]*managedSource)
+	m.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, ms := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ms.es.Close()
+		}()
+	}
+	wg.Wait()
+}
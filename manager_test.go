@@ -0,0 +1,85 @@
+package eventsource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager(t *testing.T) {
+	assert := assert.New(t)
+	srvA := httptest.NewServer(sseHandler("data: a1\n\ndata: a2\n\n"))
+	defer srvA.Close()
+	srvB := httptest.NewServer(sseHandler("data: b1\n\n"))
+	defer srvB.Close()
+	srvEnded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srvEnded.Close()
+
+	type tagged struct {
+		source string
+		result
+	}
+	msgs := make(chan tagged, 100)
+	m := NewManager(func(source string, msg Message, err error) {
+		msgs <- tagged{source, result{string(msg.ID), string(msg.Event), string(msg.Data), err}}
+	})
+	defer m.CloseAll()
+	// the manager's callback takes precedence
+	ignored, _ := collect()
+	assert.NoError(m.Add("a", WithURL(srvA.URL), WithCallback(ignored)))
+	assert.NoError(m.Add("b", WithURL(srvB.URL)))
+	assert.ErrorIs(m.Add("a", WithURL(srvB.URL)), ErrSourceExists)
+	assert.ErrorIs(m.Add("c", WithURL(srvB.URL), WithConsumingCallback(func(Message, bool, error) int { return 0 })), ErrConflictingOptions)
+	assert.Equal([]string{"a", "b"}, m.Sources())
+
+	bySource := map[string][]string{}
+	for range 3 {
+		select {
+		case msg := <-msgs:
+			assert.NoError(msg.err)
+			bySource[msg.source] = append(bySource[msg.source], msg.data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a message")
+		}
+	}
+	assert.Equal(map[string][]string{"a": {"a1", "a2"}, "b": {"b1"}}, bySource)
+
+	health, ok := m.Health("a")
+	assert.True(ok)
+	assert.Equal(uint64(2), health.Messages)
+	assert.Equal(uint64(0), health.Errors)
+	assert.False(health.LastMessageAt.IsZero())
+	assert.NotZero(health.BytesRead)
+	assert.False(health.Stopped)
+	_, ok = m.Health("c")
+	assert.False(ok)
+
+	// sources can be added and removed at runtime
+	assert.True(m.Remove("b"))
+	assert.False(m.Remove("b"))
+	assert.NoError(m.Add("ended", WithURL(srvEnded.URL)))
+	msg := <-msgs
+	assert.Equal("ended", msg.source)
+	assert.ErrorIs(msg.err, ErrStreamEnded)
+	assert.Equal([]string{"a", "ended"}, m.Sources())
+	assert.Eventually(func() bool {
+		health, _ := m.Health("ended")
+		return health.Stopped
+	}, 5*time.Second, 10*time.Millisecond)
+	health, _ = m.Health("ended")
+	assert.Equal(uint64(1), health.Errors)
+	assert.ErrorIs(health.LastError, ErrStreamEnded)
+
+	m.CloseAll()
+	assert.Empty(m.Sources())
+	select {
+	case msg := <-msgs:
+		t.Fatalf("unexpected message after CloseAll: %v", msg)
+	default:
+	}
+}
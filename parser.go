@@ -0,0 +1,72 @@
+package eventsource
+
+import (
+	"context"
+	"io"
+
+	"github.com/nsf/eventsource/buffer"
+)
+
+// Pull-based parser of an event stream, independent of HTTP. Handy for non-HTTP transports and for users who want
+// full control over the connection. Uses the same parsing code as EventSource.
+type Parser struct {
+	es    *EventSource
+	rb    *buffer.ReadBuffer
+	msg   Message
+	err   error
+	ready bool
+}
+
+// Creates a parser reading the stream from r. Zero fields of bp are replaced by the defaults. If lines are fed via
+// FeedLine only, r may be nil.
+func NewParser(r io.Reader, bp BufferParameters) *Parser {
+	p := &Parser{}
+	p.es = &EventSource{
+		bp:      bp.withDefaults(),
+		ctx:     context.Background(),
+		connCtx: context.Background(),
+	}
+	cb := Callback(func(msg Message, err error) {
+		p.msg, p.err, p.ready = msg, err, true
+	})
+	p.es.callback.Store(&cb)
+	p.rb = buffer.NewWithHook(r, p.es.bp.MaxReadBuffer, p.es.fillHook)
+	return p
+}
+
+// Returns the next message. Message slices are valid until the next call to Next.
+//
+// Errors of a single message (e.g. ErrBufferFull) are returned as is, parsing may continue after them. Read errors
+// are terminal, io.EOF is returned when the stream ends. An unterminated message at the end of the stream is
+// discarded, as per spec.
+func (p *Parser) Next() (Message, error) {
+	for {
+		line, err := p.rb.ReadLine()
+		if err != nil {
+			return Message{}, err
+		}
+		p.es.processLine(line)
+		if p.ready {
+			p.ready = false
+			return p.msg, p.err
+		}
+	}
+}
+
+// Processes a single line which was already split by the transport (without the line terminator), instead of reading
+// the stream. Returns the message once an empty line completes it, with complete set to true. If the completed
+// message was dropped (e.g. it exceeded the buffer limits), msg is nil and err is the reason, the same one Next
+// returns. Message slices are valid until the next call to FeedLine or Next. Mixing FeedLine and Next is possible, but
+// hardly useful.
+func (p *Parser) FeedLine(line []byte) (msg *Message, complete bool, err error) {
+	p.es.processLine(line)
+	if !p.ready {
+		return nil, false, nil
+	}
+	p.ready = false
+	if p.err != nil {
+		return nil, true, p.err
+	}
+	m := p.msg
+	return &m, true, nil
+}
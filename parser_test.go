@@ -0,0 +1,133 @@
+package eventsource
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parseAll collects all results until a read error, which is returned separately.
+func parseAll(p *Parser) ([]result, error) {
+	var results []result
+	for {
+		msg, err := p.Next()
+		if err != nil && !errors.Is(err, ErrBufferFull) {
+			return results, err
+		}
+		results = append(results, result{string(msg.ID), string(msg.Event), string(msg.Data), err})
+	}
+}
+
+func TestParser(t *testing.T) {
+	assert := assert.New(t)
+	check := func(stream string, expected ...result) {
+		for _, r := range []io.Reader{strings.NewReader(stream), iotest.OneByteReader(strings.NewReader(stream))} {
+			results, err := parseAll(NewParser(r, BufferParameters{}))
+			assert.ErrorIs(err, io.EOF)
+			assert.Equal(expected, results, "stream: %q", stream)
+		}
+	}
+	check("")
+	check("data: foo\n\n", result{data: "foo"})
+	check("data: foo\r\n\r\n", result{data: "foo"})
+	check("data: foo\r\rdata: bar\r\n\n", result{data: "foo"}, result{data: "bar"})
+	check("id: 1\nevent: foo\ndata: bar\ndata: baz\n\n", result{id: "1", event: "foo", data: "bar\nbaz"})
+	check(": comment\ndata:foo\n:\n\n", result{data: "foo"})
+	check("unknown: field\nretry: 1\ndata\n\n", result{})
+	// messages without data are not dispatched
+	check("id: 1\n\nevent: foo\n\ndata: bar\n\n", result{data: "bar"})
+	// unterminated message at the end of the stream is discarded
+	check("data: foo\n\ndata: bar\n", result{data: "foo"})
+	check("data: foo\n\ndata: bar", result{data: "foo"})
+}
+
+func TestParserErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	// message errors are not terminal
+	p := NewParser(strings.NewReader("data: foo\n\ndata: too long\ndata: x\n\ndata: bar\n\n"), BufferParameters{MaxData: 4})
+	results, err := parseAll(p)
+	assert.ErrorIs(err, io.EOF)
+	assert.Len(results, 3)
+	assert.Equal(result{data: "foo"}, results[0])
+	assert.ErrorIs(results[1].err, ErrBufferFull)
+	assert.Equal(result{data: "bar"}, results[2])
+
+	// read errors are terminal
+	errTest := errors.New("test")
+	p = NewParser(io.MultiReader(strings.NewReader("data: foo\n\ndata: bar"), iotest.ErrReader(errTest)), BufferParameters{})
+	results, err = parseAll(p)
+	assert.ErrorIs(err, errTest)
+	assert.Equal([]result{{data: "foo"}}, results)
+	_, err = p.Next()
+	assert.ErrorIs(err, errTest)
+}
+
+func TestParserBufferLifetime(t *testing.T) {
+	assert := assert.New(t)
+	p := NewParser(strings.NewReader("id: 1\ndata: foo\n\ndata: bar\n\n"), BufferParameters{})
+	msg, err := p.Next()
+	assert.NoError(err)
+	id := string(msg.ID)
+	data := msg.Clone()
+	assert.Equal("1", id)
+	assert.Equal("foo", string(data.Data))
+	msg, err = p.Next()
+	assert.NoError(err)
+	// the ID is not sticky, it's only set for messages which have it
+	assert.Nil(msg.ID)
+	assert.Equal("bar", string(msg.Data))
+	assert.Equal("foo", string(data.Data))
+}
+
+func TestParserFeedLine(t *testing.T) {
+	assert := assert.New(t)
+	p := NewParser(nil, BufferParameters{MaxData: 8})
+	feed := func(lines ...string) (results []result) {
+		for _, line := range lines {
+			msg, complete, err := p.FeedLine([]byte(line))
+			if !complete {
+				assert.Nil(msg)
+				assert.NoError(err)
+				continue
+			}
+			if msg == nil {
+				assert.Error(err)
+				results = append(results, result{err: err})
+			} else {
+				assert.NoError(err)
+				results = append(results, result{string(msg.ID), string(msg.Event), string(msg.Data), nil})
+			}
+		}
+		return results
+	}
+	assert.Nil(feed("id: 1", "event: foo", "data: bar"))
+	assert.Equal([]result{{id: "1", event: "foo", data: "bar"}}, feed(""))
+	assert.Equal([]result{{data: "a\nb"}}, feed(": comment", "data: a", "data: b", ""))
+	// messages without data are not complete
+	assert.Nil(feed("id: 2", ""))
+	// dropped message
+	results := feed("data: too long!", "", "data: baz", "")
+	if assert.Len(results, 2) {
+		assert.ErrorIs(results[0].err, ErrBufferFull)
+		assert.Equal(result{data: "baz"}, results[1])
+	}
+}
+
+func BenchmarkParserCommentHeavy(b *testing.B) {
+	stream := strings.Repeat(": keep-alive\n: keep-alive\n: keep-alive\n: keep-alive\nevent: tick\ndata: 1\n\n", 1000)
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p := NewParser(strings.NewReader(stream), BufferParameters{})
+		for {
+			if _, err := p.Next(); err != nil {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package eventsource
+
+// What to do when the dispatch queue is full. See: WithDispatchQueue.
+type QueueFullPolicy int
+
+const (
+	// Block the read loop until there is room in the queue. The default.
+	QueueFullBlock QueueFullPolicy = iota
+
+	// Drop the message, see DroppedMessages. Errors are never dropped.
+	QueueFullDrop
+)
+
+type queueItem struct {
+	msg  Message
+	err  error
+	size int64 // counted towards WithMaxPendingBytes
+}
+
+// Runs the callback on a dedicated goroutine fed by an in-order queue of cloned messages, a slow callback doesn't
+// block the read loop until the queue fills up, then the policy applies. Messages are delivered in order and the
+// callback is never called concurrently. Pending messages are discarded on Close, but delivered when the stream stops
+// otherwise (e.g. ErrStreamEnded). The queue may be bounded by size in bytes as well, see WithMaxPendingBytes. Can't
+// be used together with WithConsumingCallback or WithBatching.
+func WithDispatchQueue(size int, policy QueueFullPolicy) Option {
+	return func(es *EventSource) {
+		es.queueSize = size
+		es.queuePolicy = policy
+	}
+}
+
+// DroppedMessages returns the number of messages dropped because the dispatch queue was full. See:
+// WithDispatchQueue. Safe to call from any goroutine.
+func (es *EventSource) DroppedMessages() uint64 {
+	return es.droppedMessages.Load()
+}
+
+func (es *EventSource) enqueue(msg Message, err error) {
+	item := queueItem{msg: msg, err: err}
+	if es.maxPendingBytes > 0 && err == nil {
+		item.size = messageSize(msg)
+		for !es.reserveQueueBytes(item.size) {
+			if es.queuePolicy == QueueFullDrop {
+				es.droppedMessages.Add(1)
+				return
+			}
+			select {
+			case <-es.queueFreed:
+			case <-es.ctx.Done():
+				return
+			}
+		}
+	}
+	item.msg = msg.Clone()
+	if es.queuePolicy == QueueFullDrop && err == nil {
+		select {
+		case es.queue <- item:
+		default:
+			es.releaseQueueBytes(item.size)
+			es.droppedMessages.Add(1)
+		}
+		return
+	}
+	select {
+	case es.queue <- item:
+	case <-es.ctx.Done():
+	}
+}
+
+// Accounts the message as pending, reports false if it doesn't fit WithMaxPendingBytes.
+func (es *EventSource) reserveQueueBytes(size int64) bool {
+	es.queueMu.Lock()
+	defer es.queueMu.Unlock()
+	if es.queueBytes != 0 && es.queueBytes+size > es.maxPendingBytes {
+		return false
+	}
+	es.queueBytes += size
+	return true
+}
+
+// Accounts the message as handled and wakes up the read loop if it waits for room.
+func (es *EventSource) releaseQueueBytes(size int64) {
+	if size == 0 {
+		return
+	}
+	es.queueMu.Lock()
+	es.queueBytes -= size
+	es.queueMu.Unlock()
+	select {
+	case es.queueFreed <- struct{}{}:
+	default:
+	}
+}
+
+// Delivers queued messages until the queue is closed.
+func (es *EventSource) runQueue() {
+	defer close(es.queueDone)
+	for item := range es.queue {
+		if es.ctx.Err() == nil {
+			es.callCallback(item.msg, item.err)
+		}
+		// closed, pending messages are discarded
+		es.releaseQueueBytes(item.size)
+	}
+}
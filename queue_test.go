@@ -0,0 +1,117 @@
+package eventsource
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// numberedStream returns a stream of n messages with data "1", "2", etc.
+func numberedStream(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "data: %d\n\n", i)
+	}
+	return sb.String()
+}
+
+func TestDispatchQueue(t *testing.T) {
+	assert := assert.New(t)
+	release := make(chan struct{})
+	data := make(chan string, 100)
+	tr, ids := streamTransport("retry: 1\n"+numberedStream(10)+"\x00", "data: end\n\n")
+	es, err := New(WithTransport(tr), WithDispatchQueue(10, QueueFullBlock), WithCallback(func(msg Message, err error) {
+		<-release
+		data <- string(msg.Data)
+	}))
+	assert.NoError(err)
+	defer es.Close()
+	// the read loop is not blocked by the callback, the whole stream is read and EventSource reconnects
+	<-ids
+	<-ids
+	close(release)
+	for i := 1; i <= 10; i++ {
+		assert.Equal(fmt.Sprint(i), <-data)
+	}
+	assert.Equal("end", <-data)
+	assert.Zero(es.DroppedMessages())
+}
+
+func TestDispatchQueueDrop(t *testing.T) {
+	assert := assert.New(t)
+	release := make(chan struct{})
+	data := make(chan string, 100)
+	tr, _ := streamTransport(numberedStream(10))
+	es, err := New(WithTransport(tr), WithDispatchQueue(2, QueueFullDrop), WithCallback(func(msg Message, err error) {
+		<-release
+		data <- string(msg.Data)
+	}))
+	assert.NoError(err)
+	defer es.Close()
+	// one message is in the callback, two are queued, at most
+	assert.Eventually(func() bool { return es.DroppedMessages() >= 7 }, 5*time.Second, time.Millisecond)
+	close(release)
+	delivered := 10 - int(es.DroppedMessages())
+	prev := 0
+	for range delivered {
+		var i int
+		fmt.Sscan(<-data, &i)
+		assert.Greater(i, prev)
+		prev = i
+	}
+}
+
+func TestDispatchQueueClose(t *testing.T) {
+	assert := assert.New(t)
+	calls := make(chan struct{}, 100)
+	tr, _ := streamTransport(numberedStream(10))
+	es, err := New(WithTransport(tr), WithDispatchQueue(10, QueueFullBlock), WithCallback(func(msg Message, err error) {
+		calls <- struct{}{}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	assert.NoError(err)
+	<-calls
+	es.Close()
+	// pending messages are discarded and no calls are made after Close returns
+	n := len(calls)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(n, len(calls))
+	assert.Less(n, 9)
+}
+
+func TestDispatchQueueMaxPendingBytes(t *testing.T) {
+	assert := assert.New(t)
+	stream := "retry: 1\ndata: 111111\n\ndata: 222222\n\ndata: 333333\n\n"
+	for _, policy := range []QueueFullPolicy{QueueFullBlock, QueueFullDrop} {
+		release := make(chan struct{})
+		data := make(chan string, 100)
+		tr, ids := streamTransport(stream+"\x00", "data: end\n\n")
+		es, err := New(WithTransport(tr), WithDispatchQueue(10, policy), WithMaxPendingBytes(10), WithCallback(func(msg Message, err error) {
+			<-release
+			data <- string(msg.Data)
+		}))
+		assert.NoError(err)
+		<-ids
+		if policy == QueueFullBlock {
+			// the first message is being handled, the second one doesn't fit, the read loop is blocked
+			select {
+			case <-ids:
+				t.Error("the read loop isn't blocked")
+			case <-time.After(50 * time.Millisecond):
+			}
+			close(release)
+			assert.Equal([]string{"111111", "222222", "333333", "end"}, []string{<-data, <-data, <-data, <-data})
+			assert.Zero(es.DroppedMessages())
+		} else {
+			// the first message is being handled, the rest doesn't fit
+			<-ids
+			assert.Equal(uint64(2), es.DroppedMessages())
+			close(release)
+			assert.Equal([]string{"111111", "end"}, []string{<-data, <-data})
+		}
+		es.Close()
+	}
+}
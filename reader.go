@@ -0,0 +1,99 @@
+package eventsource
+
+import (
+	"bytes"
+	"io"
+)
+
+// Messages are delivered via this callback with data as a reader, see: WithReaderCallback. The data reader covers
+// exactly the data of a single message, it's streamed from the connection as the "data" lines arrive, it returns io.EOF
+// once the message is complete, or the error if the message is dropped or the connection is lost midway. The msg
+// contains the fields received before the first "data" line (servers usually send "id" and "event" first), its Data is
+// nil. The error of a dropped message is only returned by its data reader, other errors are delivered with nil data
+// (after the callback reading the data returns, if any). Both msg slices and data are invalid after the callback
+// returns, data which wasn't read by then is discarded.
+type ReaderCallback func(msg Message, data io.Reader, err error)
+
+// Sets the callback which receives message data as a reader, for large data which is better stream-parsed than
+// buffered (e.g. with json.Decoder). Unlike WithRawDataStream, the reader covers a single message. The callback is
+// called as soon as the first "data" line arrives, the read loop is blocked until the callback reads the data or
+// returns, the callback is never called concurrently. MaxData doesn't apply, the data isn't buffered. Options which
+// decide on the complete message (e.g. WithEventFilter or WithDedup) can't stop the data from being delivered, the
+// reader of such a message returns ErrMessageDiscarded at the end instead of io.EOF. Can't be used together with other
+// callbacks or with options which transform the data.
+func WithReaderCallback(callback ReaderCallback) Option {
+	return func(es *EventSource) {
+		es.readerCallback = callback
+	}
+}
+
+// Message data being streamed to the reader callback.
+type dataStream struct {
+	w    *io.PipeWriter
+	done chan struct{}
+}
+
+func (es *EventSource) callReaderCallback(msg Message, data io.Reader, err error) {
+	if es.panicHandler != nil {
+		defer es.recoverCallbackPanic()
+	}
+	es.readerCallback(msg, data, err)
+}
+
+// Streams a "data" line to the reader callback, the callback is started on the first line of the message.
+func (es *EventSource) streamData(val []byte) {
+	if es.dataStream == nil {
+		r, w := io.Pipe()
+		msg := es.message().Clone()
+		msg.Data = nil
+		es.dataStream = &dataStream{w, make(chan struct{})}
+		go func(done chan struct{}) {
+			defer close(done)
+			// unblocks the writer if the callback doesn't read everything
+			defer r.Close()
+			es.callReaderCallback(msg, r, nil)
+		}(es.dataStream.done)
+	} else {
+		es.dataStream.w.Write([]byte{'\n'})
+	}
+	// the callback may return early, the rest is discarded
+	es.dataStream.w.Write(val)
+}
+
+// Completes the data of the current message (with an error if err isn't nil) and waits for the callback to return.
+func (es *EventSource) finishDataStream(err error) {
+	if es.dataStream == nil {
+		return
+	}
+	es.dataStream.w.CloseWithError(err)
+	<-es.dataStream.done
+	es.dataStream = nil
+	// errors which came while the callback was running
+	pending := es.readerErrs
+	es.readerErrs = nil
+	for _, item := range pending {
+		es.callReaderCallback(item.msg, nil, item.err)
+	}
+}
+
+// Delivers the error. The error of the current message completes its data with the error if the callback was started
+// already. Other errors (e.g. an id store error) don't affect the data, they are delivered once the callback returns,
+// since it's never called concurrently.
+func (es *EventSource) dispatchReaderError(msg Message, err error) {
+	if es.dataStream == nil {
+		es.callReaderCallback(msg, nil, err)
+	} else if err == es.msgErr {
+		es.finishDataStream(err)
+	} else {
+		es.readerErrs = append(es.readerErrs, queueItem{msg: msg.Clone(), err: err})
+	}
+}
+
+// Delivers the complete message, or the message without data (e.g. see WithDispatchIDOnly).
+func (es *EventSource) dispatchReader(msg Message) {
+	if es.dataStream != nil {
+		es.finishDataStream(nil)
+		return
+	}
+	es.callReaderCallback(msg, bytes.NewReader(nil), nil)
+}
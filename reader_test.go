@@ -0,0 +1,102 @@
+package eventsource
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderCallback(t *testing.T) {
+	assert := assert.New(t)
+	type read struct {
+		id, event, data string
+		readErr         error
+	}
+	reads := make(chan read, 10)
+	tr, _ := streamTransport(
+		"retry: 1\nid: 1\nevent: big\ndata: {\"a\":\ndata: 1}\n\ndata: partly\ndata: read\n\ndata: third\n\ndata: cut off\n\x00",
+		"",
+	)
+	calls := 0
+	es, err := New(WithTransport(tr), WithReaderCallback(func(msg Message, data io.Reader, err error) {
+		assert.NoError(err)
+		calls++
+		switch calls {
+		case 1:
+			// stream-parse the data
+			var v struct{ A int }
+			assert.NoError(json.NewDecoder(data).Decode(&v))
+			assert.Equal(1, v.A)
+			reads <- read{id: string(msg.ID), event: string(msg.Event), data: "decoded"}
+		case 2:
+			// the rest is discarded
+			b := make([]byte, 4)
+			n, readErr := data.Read(b)
+			reads <- read{data: string(b[:n]), readErr: readErr}
+		default:
+			b, readErr := io.ReadAll(data)
+			reads <- read{data: string(b), readErr: readErr}
+		}
+	}))
+	assert.NoError(err)
+	defer es.Close()
+	assert.Equal(read{id: "1", event: "big", data: "decoded"}, <-reads)
+	assert.Equal(read{data: "part"}, <-reads)
+	assert.Equal(read{data: "third"}, <-reads)
+	// the connection is lost midway
+	assert.Equal(read{data: "cut off", readErr: io.ErrUnexpectedEOF}, <-reads)
+}
+
+func TestReaderCallbackErrors(t *testing.T) {
+	assert := assert.New(t)
+	type read struct {
+		data        string
+		readErr     error
+		callbackErr error
+	}
+	reads := make(chan read, 10)
+	store := &memStore{saveErr: errors.New("disk full")}
+	tr, _ := streamTransport("id: 1\ndata: a\n\ndata: b\ndata: c\n\ndata: d\n\n")
+	es, err := New(WithTransport(tr), WithIDStore(store), WithMaxDataLines(1), WithReaderCallback(func(msg Message, data io.Reader, err error) {
+		if data == nil {
+			reads <- read{callbackErr: err}
+			return
+		}
+		b, readErr := io.ReadAll(data)
+		reads <- read{data: string(b), readErr: readErr}
+	}))
+	assert.NoError(err)
+	defer es.Close()
+	// the unrelated error doesn't abort the data, it's delivered once the callback returns
+	assert.Equal(read{data: "a"}, <-reads)
+	r := <-reads
+	assert.ErrorIs(r.callbackErr, store.saveErr)
+	// the error of the dropped message is delivered by its data reader only
+	r = <-reads
+	assert.Equal("b", r.data)
+	assert.ErrorIs(r.readErr, ErrTooManyDataLines)
+	assert.Equal(read{data: "d"}, <-reads)
+	assert.Empty(reads)
+}
+
+func TestReaderCallbackDiscarded(t *testing.T) {
+	assert := assert.New(t)
+	type read struct {
+		event, data string
+		readErr     error
+	}
+	reads := make(chan read, 10)
+	tr, _ := streamTransport("event: y\ndata: a\n\nevent: x\ndata: b\n\n")
+	es, err := New(WithTransport(tr), WithEventFilter("x"), WithReaderCallback(func(msg Message, data io.Reader, err error) {
+		b, readErr := io.ReadAll(data)
+		reads <- read{string(msg.Event), string(b), readErr}
+	}))
+	assert.NoError(err)
+	defer es.Close()
+	// the data is streamed before the filter decides, it ends with an error
+	assert.Equal(read{"y", "a", ErrMessageDiscarded}, <-reads)
+	assert.Equal(read{"x", "b", nil}, <-reads)
+}
@@ -0,0 +1,38 @@
+package eventsource
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// recorder tees everything read from the stream to the writer.
+type recorder struct {
+	io.Reader
+	io.Closer
+}
+
+// Records raw streams to the writer, all connections one after another. Recorded streams can be replayed later via
+// ReplayTransport, that's handy for reproducing production issues. Streams are recorded after decompression, as they
+// are seen by the parser. A write error breaks the connection, it's delivered via callback as a read error.
+func WithRecorder(w io.Writer) Option {
+	return func(es *EventSource) {
+		es.recorder = w
+	}
+}
+
+// ReplayTransport returns a transport which replays the stream recorded via WithRecorder. Once the stream ends, the
+// transport returns ErrStreamEnded, thus EventSource stops.
+func ReplayTransport(r io.Reader) Transport {
+	var once sync.Once
+	return func(ctx context.Context, lastEventID []byte) (io.ReadCloser, error) {
+		var rc io.ReadCloser
+		once.Do(func() {
+			rc = io.NopCloser(r)
+		})
+		if rc == nil {
+			return nil, ErrStreamEnded
+		}
+		return rc, nil
+	}
+}
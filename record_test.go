@@ -0,0 +1,27 @@
+package eventsource
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	assert := assert.New(t)
+	var recording bytes.Buffer
+	var recorded []result
+	{
+		cb, msgs := collect()
+		tr, _ := streamTransport("retry: 1\nid: 1\ndata: foo\n\n\x00", ": comment\nevent: bar\ndata: baz\ndata: qux\n\n")
+		es, err := New(WithTransport(tr), WithCallback(cb), WithRecorder(&recording))
+		assert.NoError(err)
+		recorded = append(recorded, receive(t, msgs), receive(t, msgs))
+		es.Close()
+	}
+	cb, msgs := collect()
+	es, err := New(WithTransport(ReplayTransport(&recording)), WithCallback(cb))
+	assert.NoError(err)
+	defer es.Close()
+	assert.Equal(recorded, []result{receive(t, msgs), receive(t, msgs)})
+	assert.ErrorIs(receive(t, msgs).err, ErrStreamEnded)
+}
@@ -0,0 +1,173 @@
+package eventsource
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// This error is delivered via callback when the retry policy gives up reconnecting, it wraps the error which caused
+// the last reconnection (if any). EventSource stops after that. Use errors.Is to check for this error.
+var ErrGaveUp = errors.New("eventsource: gave up reconnecting")
+
+// RetryPolicy decides what to do before every reconnection. This is the single extension point for arbitrary
+// reconnection strategies. See: WithRetryPolicy.
+type RetryPolicy interface {
+	// NextDelay is called from the EventSource goroutine before every reconnection. The attempt is the number of
+	// consecutive reconnections since the last successful connection, starting from 1. The lastErr is the error
+	// which caused reconnection, nil if the stream simply ended. The serverRetry is the current retry timeout,
+	// either the default one or the last one set by the server via "retry" field. Returns the delay before the next
+	// connection attempt, or giveUp set to true if EventSource should stop.
+	NextDelay(attempt int, lastErr error, serverRetry time.Duration) (delay time.Duration, giveUp bool)
+}
+
+// The default retry policy, always waits for the retry timeout (see WithDefaultRetryTimeout), never gives up.
+type DefaultRetryPolicy struct{}
+
+func (DefaultRetryPolicy) NextDelay(attempt int, lastErr error, serverRetry time.Duration) (time.Duration, bool) {
+	return serverRetry, false
+}
+
+// Exponential backoff retry policy. The delay starts from the retry timeout and doubles with every attempt.
+type ExponentialBackoff struct {
+	// Maximum delay, zero means no limit.
+	Max time.Duration
+
+	// Fraction of the delay which is randomized, from 0 to 1. E.g. with 0.2 the delay is somewhere between 80% and
+	// 100% of its value. Helps to avoid reconnect storms.
+	Jitter float64
+
+	// Maximum number of consecutive attempts, zero means no limit.
+	MaxAttempts int
+}
+
+func (b ExponentialBackoff) NextDelay(attempt int, lastErr error, serverRetry time.Duration) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt > b.MaxAttempts {
+		return 0, true
+	}
+	delay := serverRetry
+	for i := 1; i < attempt && (b.Max == 0 || delay < b.Max) && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	if b.Max > 0 {
+		delay = min(delay, b.Max)
+	}
+	if b.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * b.Jitter * float64(delay))
+	}
+	return delay, false
+}
+
+// Defines when a connection is considered successful, i.e. when the attempt counter passed to the retry policy is
+// reset. See: WithBackoffResetOn.
+type BackoffResetMode int
+
+const (
+	// Reset as soon as the connection is established (e.g. HTTP response is accepted). The default.
+	BackoffResetOnConnect BackoffResetMode = iota
+
+	// Reset once the first message is received (the one which has "id", "event" or "data" field), even if it's not
+	// dispatched.
+	BackoffResetOnFirstEvent
+
+	// Reset once the first message with data is received.
+	BackoffResetOnFirstData
+)
+
+// Sets when the attempt counter (and thus the backoff) is reset. Matters for servers which accept connections they
+// can't actually serve. The default is BackoffResetOnConnect.
+func WithBackoffResetOn(mode BackoffResetMode) Option {
+	return func(es *EventSource) {
+		es.backoffResetOn = mode
+	}
+}
+
+// Sets the function called right before sleeping between reconnection attempts, with the attempt number, the delay
+// about to be slept (after backoff, jitter and Retry-After) and the error which caused reconnection (nil if the stream
+// simply ended). Handy for logging and alerting. It's not called when the retry policy gives up.
+func WithOnRetry(onRetry func(attempt int, delay time.Duration, lastErr error)) Option {
+	return func(es *EventSource) {
+		es.onRetry = onRetry
+	}
+}
+
+// Overrides the retry policy, the default is DefaultRetryPolicy. Options like WithDefaultRetryTimeout still apply,
+// they affect the serverRetry value the policy receives.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(es *EventSource) {
+		es.retryPolicy = policy
+	}
+}
+
+// Gives up reconnecting once d has passed since the connection was lost (or since the first failed attempt), a time
+// budget instead of a number of attempts, e.g. for a bounded startup window. The budget is reset once a connection is
+// established. Works on top of the retry policy, ErrGaveUp is delivered via callback as usual.
+func WithRetryDeadline(d time.Duration) Option {
+	return func(es *EventSource) {
+		es.retryDeadline = d
+	}
+}
+
+// Limits concurrent reconnects of all EventSources which share it, prevents reconnect storms in large fleets after a
+// shared outage. See: WithReconnectLimiter.
+type ReconnectLimiter interface {
+	// Blocks until the reconnect attempt is allowed. Returns ctx error if ctx is done first, EventSource stops then.
+	Acquire(ctx context.Context) error
+
+	// Called once the reconnect attempt is over, either connected or failed.
+	Release()
+}
+
+// A semaphore which allows at most n reconnect attempts at once, the simplest ReconnectLimiter.
+type ReconnectSemaphore chan struct{}
+
+// Creates a ReconnectSemaphore which allows at most n reconnect attempts at once.
+func NewReconnectSemaphore(n int) ReconnectSemaphore {
+	return make(ReconnectSemaphore, n)
+}
+
+func (s ReconnectSemaphore) Acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s ReconnectSemaphore) Release() {
+	<-s
+}
+
+// Sets the limiter which is acquired before every reconnect attempt (after the retry delay) and released once the
+// attempt is over, it's shared between EventSources to limit the number of concurrent reconnects process-wide. The
+// first connection attempt doesn't acquire it.
+func WithReconnectLimiter(limiter ReconnectLimiter) Option {
+	return func(es *EventSource) {
+		es.reconnectLimiter = limiter
+	}
+}
+
+// Returns the delay requested by the server via "Retry-After" header, if the error is a *StatusError with 429 or
+// 503 status. The header is either a number of seconds or an HTTP-date.
+func retryAfter(err error) (time.Duration, bool) {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return 0, false
+	}
+	if se.StatusCode != http.StatusTooManyRequests && se.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := se.Header.Get("Retry-After")
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,264 @@
+package eventsource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type retryCall struct {
+	attempt int
+	lastErr error
+}
+
+// giveUpOnFatal retries quickly, but gives up on errFatal.
+type giveUpOnFatal struct {
+	calls chan retryCall
+}
+
+var errFatal = errors.New("fatal")
+
+func (p giveUpOnFatal) NextDelay(attempt int, lastErr error, serverRetry time.Duration) (time.Duration, bool) {
+	p.calls <- retryCall{attempt, lastErr}
+	return time.Millisecond, errors.Is(lastErr, errFatal)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	assert := assert.New(t)
+	errTemporary := errors.New("temporary")
+	errs := []error{errTemporary, nil, errTemporary, errTemporary, errFatal}
+	tr := func(ctx context.Context, lastEventID []byte) (io.ReadCloser, error) {
+		err := errs[0]
+		errs = errs[1:]
+		if err == nil {
+			return io.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, err
+	}
+	policy := giveUpOnFatal{make(chan retryCall, 10)}
+	cb, msgs := collect()
+	es, err := New(WithTransport(tr), WithCallback(cb), WithRetryPolicy(policy))
+	assert.NoError(err)
+	defer es.Close()
+	assert.ErrorIs(receive(t, msgs).err, errTemporary)
+	assert.Equal(retryCall{1, errTemporary}, <-policy.calls)
+	// successful connection resets attempts
+	assert.Equal(retryCall{1, nil}, <-policy.calls)
+	assert.Equal(retryCall{2, errTemporary}, <-policy.calls)
+	assert.Equal(retryCall{3, errTemporary}, <-policy.calls)
+	assert.Equal(retryCall{4, errFatal}, <-policy.calls)
+	receive(t, msgs)
+	receive(t, msgs)
+	assert.ErrorIs(receive(t, msgs).err, errFatal)
+	err = receive(t, msgs).err
+	assert.ErrorIs(err, ErrGaveUp)
+	assert.ErrorIs(err, errFatal)
+	assert.NoError(es.WaitConnected(context.Background()))
+	<-es.done
+	assert.ErrorIs(es.stopErr, ErrGaveUp)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	assert := assert.New(t)
+	b := ExponentialBackoff{Max: 5 * time.Second, MaxAttempts: 5}
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		delay, giveUp := b.NextDelay(i+1, nil, time.Second)
+		assert.Equal(expected, delay)
+		assert.False(giveUp)
+	}
+	_, giveUp := b.NextDelay(6, nil, time.Second)
+	assert.True(giveUp)
+	delay, _ := ExponentialBackoff{}.NextDelay(1000, nil, time.Second)
+	assert.Greater(delay, time.Duration(0))
+	b = ExponentialBackoff{Jitter: 0.5}
+	for range 100 {
+		delay, _ := b.NextDelay(2, nil, time.Second)
+		assert.GreaterOrEqual(delay, time.Second)
+		assert.LessOrEqual(delay, 2*time.Second)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	check := func(expected time.Duration, expectedOK bool, status int, retryAfterHeader string) {
+		header := http.Header{}
+		if retryAfterHeader != "" {
+			header.Set("Retry-After", retryAfterHeader)
+		}
+		d, ok := retryAfter(fmt.Errorf("wrapped: %w", &StatusError{StatusCode: status, Header: header}))
+		assert.Equal(expected, d)
+		assert.Equal(expectedOK, ok)
+	}
+	check(30*time.Second, true, http.StatusTooManyRequests, "30")
+	check(5*time.Second, true, http.StatusServiceUnavailable, "5")
+	check(0, false, http.StatusInternalServerError, "30")
+	check(0, false, http.StatusTooManyRequests, "")
+	check(0, false, http.StatusTooManyRequests, "-1")
+	check(0, false, http.StatusTooManyRequests, "tomorrow")
+	check(0, true, http.StatusTooManyRequests, "Wed, 21 Oct 2015 07:28:00 GMT")
+	_, ok := retryAfter(errors.New("oops"))
+	assert.False(ok)
+	header := http.Header{}
+	header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	d, ok := retryAfter(&StatusError{StatusCode: http.StatusServiceUnavailable, Header: header})
+	assert.True(ok)
+	assert.InDelta(time.Hour, d, float64(2*time.Second))
+
+	// the header is honored for reconnection
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		sseHandler("data: foo\n\n")(w, r)
+	}))
+	defer srv.Close()
+	cb, msgs := collect()
+	start := time.Now()
+	es, err := New(WithURL(srv.URL), WithCallback(cb), WithDefaultRetryTimeout(time.Millisecond))
+	assert.NoError(err)
+	defer es.Close()
+	err = receive(t, msgs).err
+	var se *StatusError
+	assert.ErrorIs(err, ErrInvalidStatus)
+	assert.ErrorAs(err, &se)
+	assert.Equal(http.StatusTooManyRequests, se.StatusCode)
+	assert.Equal("1", se.Header.Get("Retry-After"))
+	assert.Equal(result{data: "foo"}, receive(t, msgs))
+	assert.GreaterOrEqual(time.Since(start), time.Second)
+}
+
+// attemptsPolicy records attempts and retries quickly.
+type attemptsPolicy chan int
+
+func (p attemptsPolicy) NextDelay(attempt int, lastErr error, serverRetry time.Duration) (time.Duration, bool) {
+	p <- attempt
+	return time.Millisecond, false
+}
+
+func TestBackoffResetOn(t *testing.T) {
+	assert := assert.New(t)
+	check := func(stream string, mode BackoffResetMode, expected []int) {
+		tr := func(ctx context.Context, lastEventID []byte) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(stream)), nil
+		}
+		policy := make(attemptsPolicy, 100)
+		es, err := New(WithTransport(tr), WithRetryPolicy(policy), WithBackoffResetOn(mode))
+		assert.NoError(err)
+		var attempts []int
+		for range expected {
+			attempts = append(attempts, <-policy)
+		}
+		assert.Equal(expected, attempts)
+		es.Close()
+	}
+	// server connects, but sends nothing
+	check("", BackoffResetOnConnect, []int{1, 1, 1})
+	check("", BackoffResetOnFirstEvent, []int{1, 2, 3})
+	check("", BackoffResetOnFirstData, []int{1, 2, 3})
+	// server sends an event without data
+	check("id: 1\n\n", BackoffResetOnFirstEvent, []int{1, 1, 1})
+	check("id: 1\n\n", BackoffResetOnFirstData, []int{1, 2, 3})
+	check("data: 1\n\n", BackoffResetOnFirstData, []int{1, 1, 1})
+}
+
+func TestOnRetry(t *testing.T) {
+	assert := assert.New(t)
+	type retry struct {
+		attempt int
+		delay   time.Duration
+		err     error
+	}
+	retries := make(chan retry, 100)
+	tr, _ := streamTransport("retry: 10\ndata: foo\n\n\x00", "data: bar\ndata: too long\n\n\x00")
+	es, err := New(
+		WithTransport(tr),
+		WithBufferParameters(BufferParameters{MaxData: 4}),
+		WithBackoffResetOn(BackoffResetOnFirstData),
+		WithOnRetry(func(attempt int, delay time.Duration, lastErr error) {
+			retries <- retry{attempt, delay, lastErr}
+		}),
+	)
+	assert.NoError(err)
+	defer es.Close()
+	assert.Equal(retry{1, 10 * time.Millisecond, nil}, <-retries)
+	assert.Equal(retry{2, 10 * time.Millisecond, nil}, <-retries)
+}
+
+func TestReconnectLimiter(t *testing.T) {
+	assert := assert.New(t)
+	var inFlight, maxInFlight, reconnects atomic.Int32
+	limiter := NewReconnectSemaphore(1)
+	newTransport := func() Transport {
+		first := true
+		return func(ctx context.Context, lastEventID []byte) (io.ReadCloser, error) {
+			if first {
+				// the first attempt isn't limited
+				first = false
+				return nil, errors.New("down")
+			}
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for m := maxInFlight.Load(); n > m && !maxInFlight.CompareAndSwap(m, n); m = maxInFlight.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+			reconnects.Add(1)
+			return nil, errors.New("down")
+		}
+	}
+	var sources []*EventSource
+	for range 3 {
+		es, err := New(WithTransport(newTransport()), WithDefaultRetryTimeout(time.Millisecond), WithReconnectLimiter(limiter))
+		assert.NoError(err)
+		sources = append(sources, es)
+	}
+	assert.Eventually(func() bool { return reconnects.Load() >= 30 }, 5*time.Second, time.Millisecond)
+	for _, es := range sources {
+		es.Close()
+	}
+	assert.Equal(int32(1), maxInFlight.Load())
+	// nothing is left acquired
+	assert.Empty(limiter)
+}
+
+func TestRetryDeadline(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Now()
+	connected := false
+	tr := func(ctx context.Context, lastEventID []byte) (io.ReadCloser, error) {
+		if !connected && time.Since(start) >= 60*time.Millisecond {
+			// the budget is reset by this connection
+			connected = true
+			return io.NopCloser(strings.NewReader("data: foo\n\n")), nil
+		}
+		return nil, errors.New("down")
+	}
+	cb, msgs := collect()
+	es, err := New(WithTransport(tr), WithCallback(cb), WithDefaultRetryTimeout(5*time.Millisecond), WithRetryDeadline(100*time.Millisecond))
+	assert.NoError(err)
+	defer es.Close()
+	for {
+		r := receive(t, msgs)
+		if errors.Is(r.err, ErrGaveUp) {
+			break
+		}
+	}
+	assert.True(connected)
+	assert.GreaterOrEqual(time.Since(start), 160*time.Millisecond)
+	select {
+	case <-es.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("EventSource didn't stop")
+	}
+}
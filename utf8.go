@@ -0,0 +1,79 @@
+package eventsource
+
+import (
+	"unicode/utf8"
+)
+
+// Returns the length of the maximal subpart of an ill-formed UTF-8 sequence at the beginning of p. That's how many
+// bytes are replaced by a single U+FFFD according to the WHATWG encoding standard (and that's what browsers do).
+func invalidUTF8Len(p []byte) int {
+	lo, hi := byte(0x80), byte(0xBF)
+	n := 0
+	switch b := p[0]; {
+	case b >= 0xC2 && b <= 0xDF:
+		n = 2
+	case b == 0xE0:
+		n, lo = 3, 0xA0
+	case b == 0xED:
+		n, hi = 3, 0x9F
+	case b >= 0xE1 && b <= 0xEF:
+		n = 3
+	case b == 0xF0:
+		n, lo = 4, 0x90
+	case b == 0xF4:
+		n, hi = 4, 0x8F
+	case b >= 0xF1 && b <= 0xF3:
+		n = 4
+	default:
+		return 1
+	}
+	i := 1
+	for ; i < n && i < len(p); i++ {
+		if p[i] < lo || p[i] > hi {
+			break
+		}
+		lo, hi = 0x80, 0xBF
+	}
+	return i
+}
+
+// Appends p to dst replacing invalid UTF-8 sequences with U+FFFD.
+func appendValidUTF8(dst, p []byte) []byte {
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		if r == utf8.RuneError && size == 1 {
+			dst = utf8.AppendRune(dst, utf8.RuneError)
+			p = p[invalidUTF8Len(p):]
+			continue
+		}
+		dst = append(dst, p[:size]...)
+		p = p[size:]
+	}
+	return dst
+}
+
+// Replaces invalid UTF-8 sequences in message fields. Validation is done on complete field values, never on read
+// buffer contents, this way a character split across several reads is reassembled before it is looked at. When
+// replacement is necessary the fields point to es.utf8Buf.
+func (es *EventSource) replaceInvalidUTF8(msg Message) Message {
+	if utf8.Valid(msg.ID) && utf8.Valid(msg.Event) && utf8.Valid(msg.Data) {
+		return msg
+	}
+	b := es.utf8Buf[:0]
+	b = appendValidUTF8(b, msg.ID)
+	idEnd := len(b)
+	b = appendValidUTF8(b, msg.Event)
+	eventEnd := len(b)
+	b = appendValidUTF8(b, msg.Data)
+	es.utf8Buf = b
+	if msg.ID != nil {
+		msg.ID = b[:idEnd:idEnd]
+	}
+	if msg.Event != nil {
+		msg.Event = b[idEnd:eventEnd:eventEnd]
+	}
+	if msg.Data != nil {
+		msg.Data = b[eventEnd:]
+	}
+	return msg
+}